@@ -14,7 +14,10 @@ import (
 	"github.com/its-me-ojas/event-driven-feed/internal/api/handlers"
 	"github.com/its-me-ojas/event-driven-feed/internal/api/middleware"
 	"github.com/its-me-ojas/event-driven-feed/internal/cache"
+	"github.com/its-me-ojas/event-driven-feed/internal/events"
 	"github.com/its-me-ojas/event-driven-feed/internal/kafka"
+	"github.com/its-me-ojas/event-driven-feed/internal/metrics"
+	"github.com/its-me-ojas/event-driven-feed/internal/outbox"
 	"github.com/its-me-ojas/event-driven-feed/internal/repository"
 	"github.com/its-me-ojas/event-driven-feed/internal/snowflake"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -25,7 +28,11 @@ func main() {
 
 	// Database
 	ctx := context.Background()
-	db, err := repository.NewDB(ctx, cfg.DatabaseURL)
+	dbPolicy := cfg.RetryPolicy()
+	dbPolicy.OnRetry = metrics.ObserveRetry("postgres")
+	breakerCfg := cfg.BreakerConfig()
+	breakerCfg.OnStateChange = metrics.ObserveBreaker("postgres")
+	db, err := repository.NewDB(ctx, cfg.DatabaseURL, dbPolicy, breakerCfg)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
@@ -42,17 +49,35 @@ func main() {
 	postsRepo := repository.NewPostsRepo(db)
 	feedsRepo := repository.NewFeedRepo(db)
 	followersRepo := repository.NewFollowersRepo(db)
-	feedCache := repository.NewFeedCache(redisClient)
+	cachePolicy := cfg.RetryPolicy()
+	cachePolicy.OnRetry = metrics.ObserveRetry("redis")
+	feedCache := repository.NewFeedCache(redisClient, cachePolicy)
 
-	// Kafka producer
-	producer := kafka.NewProducer(cfg.KafkaBrokers, cfg.PostEventTopic)
+	// Outbox: handlers write events to Postgres, the relay publishes them to Kafka
+	codec, err := events.CodecByName(cfg.EventEncoding)
+	if err != nil {
+		log.Fatalf("Invalid event encoding: %v", err)
+	}
+	outboxRepo := repository.NewOutboxRepo(db)
+	producer := kafka.NewProducer(cfg.KafkaBrokers, cfg.PostEventTopic, codec)
 	defer producer.Close()
 
+	relayCtx, stopRelay := context.WithCancel(ctx)
+	relay := outbox.NewRelay(db, outboxRepo, producer, outbox.RelayConfig{
+		PollInterval: cfg.OutboxPollInterval,
+		BatchSize:    cfg.OutboxBatch,
+	})
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		relay.Run(relayCtx)
+	}()
+
 	// ID generator
 	idGen := snowflake.NewGenerator(1)
 
 	// Handlers
-	h := handlers.NewHandler(producer, idGen, postsRepo, feedsRepo, feedCache, followersRepo)
+	h := handlers.NewHandler(db, outbox.New(outboxRepo, codec), idGen, postsRepo, feedsRepo, feedCache, followersRepo, cfg.CelebrityThreshold)
 
 	// Router
 	router := api.NewRouter(h)
@@ -88,5 +113,9 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server shutdown error: %v", err)
 	}
+
+	// Stop the relay after the last request; anything left is sent on restart
+	stopRelay()
+	<-relayDone
 	log.Println("Server stopped")
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/its-me-ojas/event-driven-feed/config"
+	"github.com/its-me-ojas/event-driven-feed/internal/api"
+	"github.com/its-me-ojas/event-driven-feed/internal/api/handlers"
+	"github.com/its-me-ojas/event-driven-feed/internal/dlq"
+	"github.com/its-me-ojas/event-driven-feed/internal/metrics"
+	"github.com/its-me-ojas/event-driven-feed/internal/repository"
+	"github.com/segmentio/kafka-go"
+)
+
+// dlq-admin copies the DLQ topic into Postgres, so dead letters outlive Kafka
+// retention, and serves the admin API for listing, retrying and discarding them
+func main() {
+	cfg := config.Load()
+
+	// Database
+	ctx := context.Background()
+	dbPolicy := cfg.RetryPolicy()
+	dbPolicy.OnRetry = metrics.ObserveRetry("postgres")
+	breakerCfg := cfg.BreakerConfig()
+	breakerCfg.OnStateChange = metrics.ObserveBreaker("postgres")
+	db, err := repository.NewDB(ctx, cfg.DatabaseURL, dbPolicy, breakerCfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	deadLetters := repository.NewDeadLetterRepo(db)
+
+	// Sink: DLQ topic -> dead_letters
+	sinkCtx, stopSink := context.WithCancel(ctx)
+	sink := dlq.NewSink(cfg.KafkaBrokers, cfg.DLQTopic, deadLetters)
+	sinkDone := make(chan struct{})
+	go func() {
+		defer close(sinkDone)
+		sink.Run(sinkCtx)
+	}()
+
+	// Hash balancer keeps each key's replays in order on the target topic
+	writer := &kafka.Writer{
+		Addr:     kafka.TCP(cfg.KafkaBrokers...),
+		Balancer: &kafka.Hash{},
+	}
+	defer writer.Close()
+
+	h := handlers.NewDeadLetterHandlers(deadLetters, dlq.NewStore(db, deadLetters, writer, cfg.DLQReplayTopics))
+	// The admin API has no authentication: keep DLQ_ADMIN_PORT off any
+	// public or shared network
+	srv := &http.Server{
+		Addr:         ":" + cfg.DLQAdminPort,
+		Handler:      api.NewAdminRouter(h),
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+	}
+
+	go func() {
+		log.Printf("DLQ admin starting on port %s, sinking %s", cfg.DLQAdminPort, cfg.DLQTopic)
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	// Wait for interrupt
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Println("Shutting down DLQ admin...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+
+	stopSink()
+	<-sinkDone
+	if err := sink.Close(); err != nil {
+		log.Printf("Failed to close DLQ sink: %v", err)
+	}
+	log.Println("DLQ admin stopped")
+}
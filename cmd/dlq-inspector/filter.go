@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/its-me-ojas/event-driven-feed/internal/events"
+	feedkafka "github.com/its-me-ojas/event-driven-feed/internal/kafka"
+	"github.com/segmentio/kafka-go"
+)
+
+// record is the decoded view of a DLQ message used for filtering and output
+type record struct {
+	Partition int        `json:"partition"`
+	Offset    int64      `json:"offset"`
+	Key       string     `json:"key"`
+	EventType string     `json:"event_type,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Reason    string     `json:"error_reason,omitempty"`
+	FailedAt  *time.Time `json:"failed_at,omitempty"`
+
+	// Where it was consumed from and who gave up on it
+	OriginalTopic   string `json:"original_topic,omitempty"`
+	SourcePartition *int   `json:"source_partition,omitempty"`
+	SourceOffset    *int64 `json:"source_offset,omitempty"`
+	ConsumerGroup   string `json:"consumer_group,omitempty"`
+	Host            string `json:"processor_host,omitempty"`
+	Version         string `json:"processor_version,omitempty"`
+
+	Attempts     int                      `json:"attempts,omitempty"`
+	ErrorHistory []feedkafka.AttemptError `json:"error_history,omitempty"`
+	StackTrace   string                   `json:"stack_trace,omitempty"`
+	ReplayCount  int                      `json:"replay_count,omitempty"`
+
+	Headers map[string]string `json:"headers"`
+	Value   string            `json:"value"`
+}
+
+func newRecord(m kafka.Message) record {
+	rec := record{
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Key:       string(m.Key),
+		Headers:   make(map[string]string, len(m.Headers)),
+		Value:     string(m.Value),
+	}
+	for _, h := range m.Headers {
+		rec.Headers[h.Key] = string(h.Value)
+	}
+	rec.Error = rec.Headers[feedkafka.HeaderError]
+	rec.Reason = rec.Headers[feedkafka.HeaderErrorReason]
+	if t, err := time.Parse(time.RFC3339, rec.Headers[feedkafka.HeaderFailedAt]); err == nil {
+		rec.FailedAt = &t
+	}
+
+	rec.OriginalTopic = rec.Headers[feedkafka.HeaderOriginalTopic]
+	if p, err := strconv.Atoi(rec.Headers[feedkafka.HeaderSourcePartition]); err == nil {
+		rec.SourcePartition = &p
+	}
+	if o, err := strconv.ParseInt(rec.Headers[feedkafka.HeaderSourceOffset], 10, 64); err == nil {
+		rec.SourceOffset = &o
+	}
+	rec.ConsumerGroup = rec.Headers[feedkafka.HeaderConsumerGroup]
+	rec.Host = rec.Headers[feedkafka.HeaderProcessorHost]
+	rec.Version = rec.Headers[feedkafka.HeaderProcessorVersion]
+	rec.Attempts, _ = strconv.Atoi(rec.Headers[feedkafka.HeaderAttempts])
+	rec.ErrorHistory, _ = feedkafka.ErrorHistory(m)
+	rec.StackTrace = rec.Headers[feedkafka.HeaderStackTrace]
+	rec.ReplayCount = feedkafka.ReplayCount(m)
+	rec.EventType = eventType(m.Value, rec.Headers[events.ContentTypeHeader])
+	return rec
+}
+
+// eventType decodes the event's type with the codec named in content-type.
+// Values the codec rejects (e.g. a newer schema) fall back to a plain JSON probe.
+func eventType(value []byte, contentType string) string {
+	if codec, err := events.CodecFor(contentType); err == nil {
+		if event, err := codec.Decode(value); err == nil {
+			return event.Type
+		}
+	}
+	var probe struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(value, &probe) == nil {
+		return probe.Type
+	}
+	return ""
+}
+
+// filter selects DLQ messages. Zero-valued fields match everything.
+type filter struct {
+	errorContains string
+	errorRegex    *regexp.Regexp
+	since, until  time.Time
+	key           string
+	eventType     string
+	minReplays    int
+}
+
+func (f *filter) match(rec record) bool {
+	if f.errorContains != "" && !strings.Contains(rec.Error, f.errorContains) {
+		return false
+	}
+	if f.errorRegex != nil && !f.errorRegex.MatchString(rec.Error) {
+		return false
+	}
+	if !f.since.IsZero() || !f.until.IsZero() {
+		if rec.FailedAt == nil {
+			return false
+		}
+		if !f.since.IsZero() && rec.FailedAt.Before(f.since) {
+			return false
+		}
+		if !f.until.IsZero() && rec.FailedAt.After(f.until) {
+			return false
+		}
+	}
+	if f.key != "" && rec.Key != f.key {
+		return false
+	}
+	if f.eventType != "" && rec.EventType != f.eventType {
+		return false
+	}
+	if rec.ReplayCount < f.minReplays {
+		return false
+	}
+	return true
+}
+
+// parseTime accepts an RFC3339 timestamp or a duration meaning "that long ago" (e.g. 2h)
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither RFC3339 nor a duration", s)
+	}
+	return time.Now().Add(-d), nil
+}
+
+// digits collapses numbers (IDs, offsets, counts) so errors group by cause
+var digits = regexp.MustCompile(`\d+`)
+
+// cause is the grouping key for the summary: the error-reason header when
+// present, plus the error text with numbers masked
+func cause(rec record) string {
+	msg := digits.ReplaceAllString(rec.Error, "N")
+	if rec.Reason != "" {
+		return rec.Reason + ": " + msg
+	}
+	return msg
+}
+
+// group is one row of the summary
+type group struct {
+	Cause      string     `json:"cause"`
+	Count      int        `json:"count"`
+	FirstAt    *time.Time `json:"first_failed_at,omitempty"`
+	LastAt     *time.Time `json:"last_failed_at,omitempty"`
+	ExampleKey string     `json:"example_key"`
+}
+
+// summary groups matched messages by cause, keeping first-seen order
+type summary struct {
+	groups map[string]*group
+	order  []string
+}
+
+func newSummary() *summary {
+	return &summary{groups: make(map[string]*group)}
+}
+
+func (s *summary) add(rec record) {
+	c := cause(rec)
+	g, ok := s.groups[c]
+	if !ok {
+		g = &group{Cause: c, ExampleKey: rec.Key}
+		s.groups[c] = g
+		s.order = append(s.order, c)
+	}
+	g.Count++
+	if rec.FailedAt != nil {
+		if g.FirstAt == nil || rec.FailedAt.Before(*g.FirstAt) {
+			g.FirstAt = rec.FailedAt
+		}
+		if g.LastAt == nil || rec.FailedAt.After(*g.LastAt) {
+			g.LastAt = rec.FailedAt
+		}
+	}
+}
+
+// sorted returns the groups, largest first
+func (s *summary) sorted() []*group {
+	out := make([]*group, len(s.order))
+	for i, c := range s.order {
+		out[i] = s.groups[c]
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Count > out[j].Count
+	})
+	return out
+}
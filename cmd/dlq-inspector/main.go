@@ -2,23 +2,75 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"hash/fnv"
 	"log"
 	"os"
 	"os/signal"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/its-me-ojas/event-driven-feed/config"
+	feedkafka "github.com/its-me-ojas/event-driven-feed/internal/kafka"
 	"github.com/segmentio/kafka-go"
 )
 
 func main() {
-	mode := flag.String("mode", "inspect", "Mode: inspect or replay")
-	limit := flag.Int("limit", 10, "Number of messages to process")
+	mode := flag.String("mode", "inspect", "Mode: inspect, replay, or patch (replay with a JSON merge patch applied)")
+	limit := flag.Int("limit", 10, "Number of messages to process (0 = all)")
+	format := flag.String("format", "text", "Inspect output: text or json (one object per line)")
+	summarize := flag.Bool("summary", false, "Inspect: group matching messages by error cause instead of listing them")
+	errorContains := flag.String("error", "", "Filter: only messages whose error header contains this")
+	errorRegex := flag.String("error-regex", "", "Filter: only messages whose error header matches this regex")
+	since := flag.String("since", "", "Filter: only messages failed at or after this time (RFC3339, or a duration ago like 2h)")
+	until := flag.String("until", "", "Filter: only messages failed at or before this time (RFC3339, or a duration ago)")
+	key := flag.String("key", "", "Filter: only messages with this key")
+	eventType := flag.String("type", "", "Filter: only events of this type (e.g. POST_CREATED)")
+	minReplays := flag.Int("min-replays", 0, "Filter: only messages already replayed at least this many times")
+	dryRun := flag.Bool("dry-run", false, "Replay: show what would be replayed without writing or committing")
+	rate := flag.Float64("rate", 0, "Replay: max messages per second (0 = unlimited)")
+	group := flag.String("group", "", "Replay: consumer group to resume from (default derived from the filters)")
+	targetTopic := flag.String("target-topic", "", "Replay: send to this topic instead of the original-topic header")
+	patchFile := flag.String("patch", "", "Patch: JSON merge patch (RFC 7386) applied to each event before replay")
+	auditFile := flag.String("audit", "dlq-patch-audit.jsonl", "Patch: file the original and patched payloads are appended to")
 	flag.Parse()
 
+	if *mode != "inspect" && *mode != "replay" && *mode != "patch" {
+		log.Fatalf("Invalid -mode %q (want inspect, replay or patch)", *mode)
+	}
+	// Patch mode is replay with a transform; it shares the replay flags
+	replaying := *mode == "replay" || *mode == "patch"
+
+	var patch any
+	if *mode == "patch" {
+		if *patchFile == "" {
+			log.Fatal("-mode patch requires -patch")
+		}
+		var err error
+		if patch, err = loadPatch(*patchFile); err != nil {
+			log.Fatalf("Invalid patch: %v", err)
+		}
+	}
+
+	if *format != "text" && *format != "json" {
+		log.Fatalf("Invalid -format %q (want text or json)", *format)
+	}
+	f, err := buildFilter(*errorContains, *errorRegex, *since, *until, *key, *eventType, *minReplays)
+	if err != nil {
+		log.Fatalf("Invalid filter: %v", err)
+	}
+	// A summary of the first few matches is misleading: scan everything
+	// unless -limit was given explicitly
+	if *summarize && !flagSet("limit") {
+		*limit = 0
+	}
+
 	cfg := config.Load()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -31,30 +83,74 @@ func main() {
 		cancel()
 	}()
 
+	// Inspect reads everything under a throwaway group. Replay commits under a
+	// stable group so an interrupted replay resumes where it stopped.
+	groupID := "dlq-inspector-" + time.Now().Format("20060102150405")
+	if replaying {
+		groupID = *group
+		if groupID == "" {
+			// A patch run is its own replay: the patch is part of the group's identity
+			filters := []string{*mode, *patchFile, *errorContains, *errorRegex, *since, *until, *key, *eventType}
+			if *minReplays > 0 {
+				filters = append(filters, strconv.Itoa(*minReplays))
+			}
+			// A replay to another topic must not skip messages for the original one
+			if *targetTopic != "" {
+				filters = append(filters, "target="+*targetTopic)
+			}
+			groupID = replayGroup(filters...)
+		}
+	}
+
 	// Connect to DLQ
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:     cfg.KafkaBrokers,
 		Topic:       cfg.DLQTopic,
-		GroupID:     "dlq-inspector-" + time.Now().Format("20060102150405"), // Unique group to see all msgs
+		GroupID:     groupID,
 		StartOffset: kafka.FirstOffset,
 	})
 	defer reader.Close()
 
 	// Producer for Replay
 	var writer *kafka.Writer
-	if *mode == "replay" {
+	if replaying && !*dryRun {
+		// Hash balancer keeps a key's replays on one partition, in order
 		writer = &kafka.Writer{
 			Addr:     kafka.TCP(cfg.KafkaBrokers...),
-			Balancer: &kafka.LeastBytes{},
+			Balancer: &kafka.Hash{},
 		}
 		defer writer.Close()
 	}
 
-	fmt.Printf("Starting DLQ Inspector (Mode: %s, Limit: %d)\n", *mode, *limit)
-	fmt.Println("---------------------------------------------------")
+	var audit *auditLog
+	if *mode == "patch" && !*dryRun {
+		var err error
+		if audit, err = openAuditLog(*auditFile); err != nil {
+			log.Fatalf("Failed to open audit file: %v", err)
+		}
+		defer audit.Close()
+	}
 
+	// Status lines go to stderr so stdout can be piped
+	fmt.Fprintf(os.Stderr, "Starting DLQ Inspector (Mode: %s, Limit: %d)\n", *mode, *limit)
+	if replaying {
+		fmt.Fprintf(os.Stderr, "Replay group: %s (dry run: %v)\n", groupID, *dryRun)
+	}
+
+	// Pace replays to at most rate messages per second
+	var throttle <-chan time.Time
+	if replaying && *rate > 0 && !*dryRun {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / *rate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+	if *format == "text" && !*summarize {
+		fmt.Println("---------------------------------------------------")
+	}
+
+	groups := newSummary()
 	count := 0
-	for count < *limit {
+	for *limit == 0 || count < *limit {
 		// Set a read deadline so we don't block forever if empty
 		readCtx, readCancel := context.WithTimeout(ctx, 5*time.Second)
 		m, err := reader.FetchMessage(readCtx)
@@ -65,63 +161,214 @@ func main() {
 				break
 			}
 			if err == context.DeadlineExceeded {
-				fmt.Println("No more messages found (timeout).")
+				fmt.Fprintln(os.Stderr, "No more messages found (timeout).")
 				break
 			}
 			log.Printf("Error fetching message: %v", err)
 			continue
 		}
 
+		// Non-matching messages are skipped; in replay they are passed over
+		// by this filter's group only, so other filters still see them
+		rec := newRecord(m)
+		if !f.match(rec) {
+			continue
+		}
+
 		if *mode == "inspect" {
-			printMessage(m)
-		} else if *mode == "replay" {
-			if err := replayMessage(ctx, writer, m); err != nil {
-				log.Printf("Failed to replay message: %v", err)
-			} else {
-				fmt.Printf("Replayed message: %s\n", string(m.Key))
-				// Only commit if replayed successfully
-				reader.CommitMessages(ctx, m)
+			switch {
+			case *summarize:
+				groups.add(rec)
+			case *format == "json":
+				printJSON(rec)
+			default:
+				printMessage(rec)
+			}
+		} else {
+			target := *targetTopic
+			if target == "" {
+				target = rec.Headers["original-topic"]
+			}
+
+			var patched []byte
+			if patch != nil {
+				if patched, err = patchValue(m, patch); err != nil {
+					if *dryRun {
+						fmt.Printf("Would stop: key=%s type=%s offset=%d, patch failed: %v\n", rec.Key, rec.EventType, rec.Offset, err)
+						count++
+						continue
+					}
+					// Stop like a failed replay: committing a later message
+					// would skip this one for good
+					log.Printf("Patch failed for message at offset %d, stopping: %v", m.Offset, err)
+					break
+				}
+			}
+
+			if *dryRun {
+				fmt.Printf("Would replay: key=%s type=%s offset=%d -> %s\n", rec.Key, rec.EventType, rec.Offset, target)
+				if patched != nil {
+					fmt.Printf("  original: %s\n  patched:  %s\n", auditValue(m.Value), auditValue(patched))
+				}
+				count++
+				continue
+			}
+
+			if throttle != nil {
+				select {
+				case <-throttle:
+				case <-ctx.Done():
+				}
+				if ctx.Err() != nil {
+					break
+				}
+			}
+			if patched != nil {
+				// Audit first: a patched event must never be published unrecorded
+				if err := audit.record(m, patched, target); err != nil {
+					log.Printf("Failed to write audit entry for offset %d, stopping: %v", m.Offset, err)
+					break
+				}
+				m.Value = patched
+			}
+			if err := feedkafka.ReplayMessage(ctx, writer, m, *targetTopic); err != nil {
+				// Stop rather than commit past it, so the next run retries it
+				log.Printf("Failed to replay message at offset %d, stopping: %v", m.Offset, err)
+				break
+			}
+			fmt.Printf("Replayed message: %s\n", string(m.Key))
+			// Only commit if replayed successfully
+			if err := reader.CommitMessages(ctx, m); err != nil {
+				log.Printf("Commit error: %v", err)
 			}
 		}
 
 		count++
 	}
+
+	if *summarize {
+		printSummary(groups, *format)
+	}
+}
+
+// buildFilter validates the filter flags shared by inspect and replay
+func buildFilter(errorContains, errorRegex, since, until, key, eventType string, minReplays int) (*filter, error) {
+	f := &filter{errorContains: errorContains, key: key, eventType: eventType, minReplays: minReplays}
+	if errorRegex != "" {
+		re, err := regexp.Compile(errorRegex)
+		if err != nil {
+			return nil, fmt.Errorf("-error-regex: %w", err)
+		}
+		f.errorRegex = re
+	}
+	var err error
+	if f.since, err = parseTime(since); err != nil {
+		return nil, fmt.Errorf("-since: %w", err)
+	}
+	if f.until, err = parseTime(until); err != nil {
+		return nil, fmt.Errorf("-until: %w", err)
+	}
+	return f, nil
+}
+
+// replayGroup names the replay consumer group after the filters, so each
+// filtered replay resumes on its own and never skips messages for another
+func replayGroup(filters ...string) string {
+	h := fnv.New32a()
+	for _, f := range filters {
+		h.Write([]byte(f))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("dlq-replayer-%08x", h.Sum32())
+}
+
+// flagSet reports whether a flag was passed on the command line
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
-func printMessage(m kafka.Message) {
-	fmt.Printf("Key: %s\n", string(m.Key))
-	fmt.Printf("Value: %s\n", string(m.Value))
+func printMessage(rec record) {
+	fmt.Printf("Partition: %d  Offset: %d\n", rec.Partition, rec.Offset)
+	fmt.Printf("Key: %s\n", rec.Key)
+	if rec.EventType != "" {
+		fmt.Printf("Type: %s\n", rec.EventType)
+	}
+	if rec.SourcePartition != nil && rec.SourceOffset != nil {
+		fmt.Printf("Source: %s partition %d offset %d\n", rec.OriginalTopic, *rec.SourcePartition, *rec.SourceOffset)
+	}
+	if rec.ConsumerGroup != "" {
+		fmt.Printf("Failed in: %s on %s (version %s)\n", rec.ConsumerGroup, rec.Host, rec.Version)
+	}
+	if rec.Attempts > 0 || rec.ReplayCount > 0 {
+		fmt.Printf("Attempts: %d  Replays: %d\n", rec.Attempts, rec.ReplayCount)
+	}
+	if len(rec.ErrorHistory) > 0 {
+		fmt.Println("Error history:")
+		for _, a := range rec.ErrorHistory {
+			fmt.Printf("  #%d %s %s: %s\n", a.Attempt, a.At.Format(time.RFC3339), a.Topic, a.Error)
+		}
+	}
+	if rec.StackTrace != "" {
+		fmt.Println("Stack trace:")
+		fmt.Println("  " + strings.ReplaceAll(strings.TrimSpace(rec.StackTrace), "\n", "\n  "))
+	}
+	fmt.Printf("Value: %s\n", rec.Value)
 	fmt.Println("Headers:")
-	for _, h := range m.Headers {
-		fmt.Printf("  - %s: %s\n", h.Key, string(h.Value))
+	for _, k := range sortedKeys(rec.Headers) {
+		// Shown in full above
+		if k == feedkafka.HeaderErrorHistory || k == feedkafka.HeaderStackTrace {
+			continue
+		}
+		fmt.Printf("  - %s: %s\n", k, rec.Headers[k])
 	}
 	fmt.Println("---------------------------------------------------")
 }
 
-func replayMessage(ctx context.Context, w *kafka.Writer, m kafka.Message) error {
-	var originalTopic string
-
-	// Find original topic from headers
-	// We filter out the error headers so we don't pollute the replayed message
-	var cleanHeaders []kafka.Header
-	for _, h := range m.Headers {
-		if h.Key == "original-topic" {
-			originalTopic = string(h.Value)
-		} else if h.Key != "error" && h.Key != "failed-at" {
-			cleanHeaders = append(cleanHeaders, h)
-		}
+func printJSON(v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Failed to encode output: %v", err)
+		return
 	}
+	fmt.Println(string(data))
+}
 
-	if originalTopic == "" {
-		return fmt.Errorf("could not find original-topic header")
+func printSummary(s *summary, format string) {
+	groups := s.sorted()
+	if format == "json" {
+		for _, g := range groups {
+			printJSON(g)
+		}
+		return
 	}
 
-	msg := kafka.Message{
-		Topic:   originalTopic,
-		Key:     m.Key,
-		Value:   m.Value,
-		Headers: cleanHeaders,
+	total := 0
+	for _, g := range groups {
+		total += g.Count
+	}
+	fmt.Printf("%d messages, %d causes\n", total, len(groups))
+	fmt.Println("---------------------------------------------------")
+	for _, g := range groups {
+		fmt.Printf("%6d  %s\n", g.Count, g.Cause)
+		if g.FirstAt != nil {
+			fmt.Printf("        first %s, last %s, e.g. key %s\n", g.FirstAt.Format(time.RFC3339), g.LastAt.Format(time.RFC3339), g.ExampleKey)
+		} else {
+			fmt.Printf("        e.g. key %s\n", g.ExampleKey)
+		}
 	}
+}
 
-	return w.WriteMessages(ctx, msg)
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
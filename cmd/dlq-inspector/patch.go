@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/its-me-ojas/event-driven-feed/internal/events"
+	"github.com/segmentio/kafka-go"
+)
+
+// loadPatch reads a JSON merge patch (RFC 7386) from path
+func loadPatch(path string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := decodeJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return patch, nil
+}
+
+// decodeJSON keeps numbers as json.Number so 64-bit IDs survive the round trip
+func decodeJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// mergePatch applies patch to target as described in RFC 7386: objects merge
+// recursively, null deletes a field, anything else replaces the target
+func mergePatch(target, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = make(map[string]any)
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+			continue
+		}
+		targetObj[k] = mergePatch(targetObj[k], v)
+	}
+	return targetObj
+}
+
+// patchValue applies patch to a message value. The value is patched as the
+// event's JSON form and re-encoded with the codec it arrived in, and the
+// result must still decode as an event.
+func patchValue(m kafka.Message, patch any) ([]byte, error) {
+	codec, err := events.CodecFor(headerOf(m, events.ContentTypeHeader))
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON values are patched as-is; other encodings go through the Event struct
+	doc := m.Value
+	if codec.ContentType() != events.ContentTypeJSON {
+		event, err := codec.Decode(m.Value)
+		if err != nil {
+			return nil, fmt.Errorf("decode original: %w", err)
+		}
+		if doc, err = json.Marshal(event); err != nil {
+			return nil, err
+		}
+	}
+
+	target, err := decodeJSON(doc)
+	if err != nil {
+		return nil, fmt.Errorf("decode original: %w", err)
+	}
+	patched, err := json.Marshal(mergePatch(target, patch))
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := events.Unmarshal(patched)
+	if err != nil {
+		return nil, fmt.Errorf("patched value is not a valid event: %w", err)
+	}
+	if codec.ContentType() == events.ContentTypeJSON {
+		return patched, nil
+	}
+	return codec.Encode(event)
+}
+
+func headerOf(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// auditEntry is one line of the patch audit file
+type auditEntry struct {
+	At          time.Time       `json:"at"`
+	Partition   int             `json:"partition"`
+	Offset      int64           `json:"offset"`
+	Key         string          `json:"key"`
+	TargetTopic string          `json:"target_topic"`
+	Original    json.RawMessage `json:"original"`
+	Patched     json.RawMessage `json:"patched"`
+}
+
+// auditLog appends patched messages to a JSON lines file
+type auditLog struct {
+	file *os.File
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{file: f}, nil
+}
+
+// record writes an entry and syncs it, so the audit survives a crash
+// between the write and the replay
+func (a *auditLog) record(m kafka.Message, patched []byte, targetTopic string) error {
+	entry := auditEntry{
+		At:          time.Now(),
+		Partition:   m.Partition,
+		Offset:      m.Offset,
+		Key:         string(m.Key),
+		TargetTopic: targetTopic,
+		Original:    auditValue(m.Value),
+		Patched:     auditValue(patched),
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+func (a *auditLog) Close() error {
+	return a.file.Close()
+}
+
+// auditValue embeds JSON payloads as-is and anything else (protobuf) as a base64 string
+func auditValue(value []byte) json.RawMessage {
+	if json.Valid(value) {
+		return value
+	}
+	encoded, _ := json.Marshal(value)
+	return encoded
+}
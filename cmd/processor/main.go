@@ -6,46 +6,112 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/its-me-ojas/event-driven-feed/config"
+	"github.com/its-me-ojas/event-driven-feed/internal/cache"
+	"github.com/its-me-ojas/event-driven-feed/internal/events"
 	"github.com/its-me-ojas/event-driven-feed/internal/kafka"
+	"github.com/its-me-ojas/event-driven-feed/internal/metrics"
+	"github.com/its-me-ojas/event-driven-feed/internal/outbox"
 	"github.com/its-me-ojas/event-driven-feed/internal/processor"
 	"github.com/its-me-ojas/event-driven-feed/internal/repository"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// version is stamped on dead letters; set it at build time with
+// -ldflags "-X main.version=v1.2.3" (defaults to the module version)
+var version string
+
 func main() {
 	// 1. Load Configuration
 	cfg := config.Load()
 
 	// 2. Connect to Database
-	db, err := repository.NewDB(context.Background(), cfg.DatabaseURL)
+	dbPolicy := cfg.RetryPolicy()
+	dbPolicy.OnRetry = metrics.ObserveRetry("postgres")
+	breakerCfg := cfg.BreakerConfig()
+	breakerCfg.OnStateChange = metrics.ObserveBreaker("postgres")
+	db, err := repository.NewDB(context.Background(), cfg.DatabaseURL, dbPolicy, breakerCfg)
 	if err != nil {
 		log.Fatalf("Failed to connect to DB: %v", err)
 	}
 	defer db.Close()
 
+	// Redis (cached feeds are updated or evicted as events land)
+	redisClient, err := cache.NewRedisClient(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB)
+	if err != nil {
+		log.Fatalf("Failed to connect to Redis: %v", err)
+	}
+	defer redisClient.Close()
+
 	// 3. Initialize Repositories
 	idempotencyRepo := repository.NewIdempotencyRepo(db)
 	feedRepo := repository.NewFeedRepo(db)
 	followersRepo := repository.NewFollowersRepo(db)
 	postsRepo := repository.NewPostsRepo(db)
+	cachePolicy := cfg.RetryPolicy()
+	cachePolicy.OnRetry = metrics.ObserveRetry("redis")
+	feedCache := repository.NewFeedCache(redisClient, cachePolicy)
 
-	// 4. Initialize Handler (The Business Logic)
-	handler := processor.NewEventHandler(idempotencyRepo, feedRepo, followersRepo, postsRepo)
+	// Feed updates for downstream consumers (disabled when the topic is empty).
+	// They are queued in the outbox with the fan-out and published by the
+	// relay, which shares its lock with the API's relays.
+	var feedPublisher processor.FeedPublisher
+	var relay *outbox.Relay
+	if cfg.FeedEventTopic != "" {
+		outboxRepo := repository.NewOutboxRepo(db)
+		feedPublisher = outbox.New(outboxRepo, events.JSONCodec).ForTopic(cfg.FeedEventTopic)
+		relayProducer := kafka.NewProducer(cfg.KafkaBrokers, cfg.PostEventTopic, events.JSONCodec)
+		defer relayProducer.Close()
+		relay = outbox.NewRelay(db, outboxRepo, relayProducer, outbox.RelayConfig{
+			PollInterval: cfg.OutboxPollInterval,
+			BatchSize:    cfg.OutboxBatch,
+		})
+	}
+
+	// 4. Initialize Handlers (The Business Logic)
+	// Every event type gets the same middleware; new types just Register here
+	registry := processor.NewRegistry(
+		processor.Tracing(),
+		processor.Idempotency(idempotencyRepo),
+		processor.Metrics(),
+	)
+	feedHandlers := processor.NewFeedHandlers(db, feedRepo, followersRepo, postsRepo, feedCache, feedPublisher, processor.HandlerConfig{
+		BackfillLimit:      cfg.FollowBackfillLimit,
+		CelebrityThreshold: cfg.CelebrityThreshold,
+		FanoutChunkSize:    cfg.FanoutChunkSize,
+		FeedCacheMaxLen:    cfg.FeedCacheMaxLen,
+	})
+	feedHandlers.Register(registry)
+	handler := processor.NewEventHandler(db, idempotencyRepo, registry)
 
 	// 5. Initialize Kafka Consumer (The Transport Layer)
+	consumerPolicy := cfg.RetryPolicy()
+	consumerPolicy.OnRetry = metrics.ObserveRetry("consumer")
 	consumerCfg := kafka.ConsumerConfig{
-		Brokers:    cfg.KafkaBrokers,
-		Topic:      "post-events",
-		GroupID:    "feed-processor-group",
-		DLQTopic:   "dead-letter-events",
-		MaxRetries: 3,
+		Brokers:      cfg.KafkaBrokers,
+		Topic:        cfg.PostEventTopic,
+		GroupID:      "feed-processor-group",
+		DLQTopic:     cfg.DLQTopic,
+		ParkingTopic: cfg.ParkingTopic,
+		Retry:        consumerPolicy,
+		RetryDelays:  cfg.RetryTiers,
+		Workers:      cfg.ConsumerWorkers,
+		BatchSize:    cfg.ConsumerBatch,
+		Breaker:      db.Breaker,
+		Version:      version,
 	}
 	consumer := kafka.NewConsumer(consumerCfg)
 	defer consumer.Close()
 
+	// Retry tier consumers drain the delay topics next to the main loop
+	retryConsumers := kafka.NewRetryConsumers(consumerCfg)
+	for _, rc := range retryConsumers {
+		defer rc.Close()
+	}
+
 	// Start a separate HTTP server for metrics
 	// This runs in a goroutine so it doesn't block the main thread
 	go func() {
@@ -69,6 +135,34 @@ func main() {
 	}()
 
 	// 7. Start Processing Loop
+	var wg sync.WaitGroup
+	// Fan-outs interrupted by a crash or a failed chunk are finished here
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		feedHandlers.ResumeFanouts(ctx, cfg.FanoutResumeInterval)
+	}()
+	if relay != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			relay.Run(ctx)
+		}()
+	}
+	for _, rc := range retryConsumers {
+		wg.Add(1)
+		go func(rc *kafka.Consumer) {
+			defer wg.Done()
+			rc.ConsumeLoop(ctx, handler.Handle)
+		}(rc)
+	}
+	defer wg.Wait()
+
+	if cfg.ConsumerMode == "batch" {
+		log.Printf("Starting feed processor (batch mode, up to %d messages)...", cfg.ConsumerBatch)
+		consumer.ConsumeBatchLoop(ctx, handler.HandleBatch, handler.Handle)
+		return
+	}
 	log.Println("Starting feed processor...")
 	consumer.ConsumeLoop(ctx, handler.Handle)
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/its-me-ojas/event-driven-feed/config"
+	"github.com/its-me-ojas/event-driven-feed/internal/repository"
+)
+
+// reconcile-stats repairs drift between user_stats and the followers table
+func main() {
+	cfg := config.Load()
+	ctx := context.Background()
+
+	db, err := repository.NewDB(ctx, cfg.DatabaseURL, cfg.RetryPolicy(), cfg.BreakerConfig())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	followersRepo := repository.NewFollowersRepo(db)
+
+	fixed, err := followersRepo.ReconcileStats(ctx)
+	if err != nil {
+		log.Fatalf("Reconciliation failed: %v", err)
+	}
+	fmt.Printf("Reconciled user_stats: %d rows repaired\n", fixed)
+}
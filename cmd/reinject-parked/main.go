@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/its-me-ojas/event-driven-feed/config"
+	"github.com/its-me-ojas/event-driven-feed/internal/events"
+	feedkafka "github.com/its-me-ojas/event-driven-feed/internal/kafka"
+	"github.com/segmentio/kafka-go"
+)
+
+// reinject-parked moves parked events back onto their original topic once a
+// processor that understands their type is deployed. It reads the parking
+// topic with a fixed consumer group, so each parked event is re-injected once,
+// and stops at the offsets the topic ended at when it started: anything parked
+// again during the run (by a processor that still doesn't know the type, or by
+// the -type filter) waits for the next run.
+func main() {
+	eventType := flag.String("type", "", "Only re-inject events of this type (others stay parked)")
+	limit := flag.Int("limit", 0, "Max messages to re-inject (0 = all)")
+	flag.Parse()
+
+	cfg := config.Load()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Handle shutdown
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		cancel()
+	}()
+
+	// Snapshot where each partition ends so re-parked messages aren't read again
+	end, err := endOffsets(ctx, cfg.KafkaBrokers[0], cfg.ParkingTopic)
+	if err != nil {
+		log.Fatalf("Failed to read parking topic offsets: %v", err)
+	}
+	done := make(map[int]bool)
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     cfg.KafkaBrokers,
+		Topic:       cfg.ParkingTopic,
+		GroupID:     "parking-reinjector",
+		StartOffset: kafka.FirstOffset,
+	})
+	defer reader.Close()
+
+	// Hash balancer keeps each key's events in order on the original topic
+	writer := &kafka.Writer{
+		Addr:     kafka.TCP(cfg.KafkaBrokers...),
+		Balancer: &kafka.Hash{},
+	}
+	defer writer.Close()
+
+	fmt.Printf("Re-injecting parked events from %s (type: %q, limit: %d)\n", cfg.ParkingTopic, *eventType, *limit)
+
+	reinjected, kept := 0, 0
+	for (*limit == 0 || reinjected < *limit) && len(done) < len(end) {
+		// Stop once the parking topic has been drained
+		readCtx, readCancel := context.WithTimeout(ctx, 5*time.Second)
+		m, err := reader.FetchMessage(readCtx)
+		readCancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			if err == context.DeadlineExceeded {
+				fmt.Println("No more parked messages (timeout).")
+				break
+			}
+			log.Printf("Error fetching message: %v", err)
+			continue
+		}
+
+		// Past the snapshot: leave the rest of this partition uncommitted
+		if m.Offset >= end[m.Partition] {
+			done[m.Partition] = true
+			continue
+		}
+
+		out, err := feedkafka.Unpark(m)
+		if err != nil {
+			log.Printf("Skipping message at offset %d: %v", m.Offset, err)
+			reader.CommitMessages(ctx, m)
+			continue
+		}
+
+		// Filtered-out events are parked again so committing never loses them
+		if *eventType != "" && typeOf(m) != *eventType {
+			out = kafka.Message{Topic: cfg.ParkingTopic, Key: m.Key, Value: m.Value, Headers: m.Headers}
+			kept++
+		} else {
+			reinjected++
+		}
+
+		if err := writer.WriteMessages(ctx, out); err != nil {
+			log.Printf("Failed to write message at offset %d: %v", m.Offset, err)
+			break
+		}
+		// Only commit once the message is safely written
+		if err := reader.CommitMessages(ctx, m); err != nil {
+			log.Printf("Commit error: %v", err)
+		}
+	}
+
+	fmt.Printf("Re-injected %d events, %d left parked\n", reinjected, kept)
+}
+
+// typeOf decodes a parked message's event type, or returns "" if it can't
+func typeOf(m kafka.Message) string {
+	var contentType string
+	for _, h := range m.Headers {
+		if h.Key == events.ContentTypeHeader {
+			contentType = string(h.Value)
+		}
+	}
+	codec, err := events.CodecFor(contentType)
+	if err != nil {
+		return ""
+	}
+	event, err := codec.Decode(m.Value)
+	if err != nil {
+		return ""
+	}
+	return event.Type
+}
+
+// endOffsets returns the next offset of every partition of topic
+func endOffsets(ctx context.Context, broker, topic string) (map[int]int64, error) {
+	conn, err := kafka.DialContext(ctx, "tcp", broker)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	partitions, err := conn.ReadPartitions(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	end := make(map[int]int64, len(partitions))
+	for _, p := range partitions {
+		leader, err := kafka.DialLeader(ctx, "tcp", broker, topic, p.ID)
+		if err != nil {
+			return nil, fmt.Errorf("partition %d: %w", p.ID, err)
+		}
+		offset, err := leader.ReadLastOffset()
+		leader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("partition %d: %w", p.ID, err)
+		}
+		end[p.ID] = offset
+	}
+	return end, nil
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/its-me-ojas/event-driven-feed/internal/dlq"
+	"github.com/its-me-ojas/event-driven-feed/internal/repository"
+	"github.com/jackc/pgx/v5"
+)
+
+// DeadLetterHandlers serves the admin API over the dead_letters table
+type DeadLetterHandlers struct {
+	repo  *repository.DeadLetterRepo
+	store *dlq.Store
+}
+
+func NewDeadLetterHandlers(repo *repository.DeadLetterRepo, store *dlq.Store) *DeadLetterHandlers {
+	return &DeadLetterHandlers{repo: repo, store: store}
+}
+
+type DeadLetterResponse struct {
+	ID            int64                         `json:"id"`
+	Topic         string                        `json:"topic"`
+	Partition     int                           `json:"partition"`
+	Offset        int64                         `json:"offset"`
+	Key           string                        `json:"key"`
+	Payload       json.RawMessage               `json:"payload"` // JSON as-is, anything else as base64
+	Headers       []repository.DeadLetterHeader `json:"headers"`
+	OriginalTopic string                        `json:"original_topic"`
+	Error         string                        `json:"error"`
+	ErrorReason   string                        `json:"error_reason"`
+	Attempts      int                           `json:"attempts"`
+	Status        string                        `json:"status"`
+	FailedAt      *time.Time                    `json:"failed_at,omitempty"`
+	CreatedAt     time.Time                     `json:"created_at"`
+	UpdatedAt     time.Time                     `json:"updated_at"`
+}
+
+type ListDeadLettersResponse struct {
+	DeadLetters []DeadLetterResponse `json:"dead_letters"`
+	NextAfter   int64                `json:"next_after,omitempty"` // pass as ?after= for the next page
+}
+
+type RetryDeadLetterRequest struct {
+	TargetTopic string `json:"target_topic"` // defaults to the original topic; others must be in DLQ_REPLAY_TOPICS
+}
+
+func newDeadLetterResponse(dl *repository.DeadLetter) DeadLetterResponse {
+	payload := json.RawMessage(dl.Payload)
+	if !json.Valid(dl.Payload) {
+		payload, _ = json.Marshal(dl.Payload)
+	}
+	return DeadLetterResponse{
+		ID:            dl.ID,
+		Topic:         dl.Topic,
+		Partition:     dl.Partition,
+		Offset:        dl.Offset,
+		Key:           string(dl.Key),
+		Payload:       payload,
+		Headers:       dl.Headers,
+		OriginalTopic: dl.OriginalTopic,
+		Error:         dl.Error,
+		ErrorReason:   dl.ErrorReason,
+		Attempts:      dl.Attempts,
+		Status:        dl.Status,
+		FailedAt:      dl.FailedAt,
+		CreatedAt:     dl.CreatedAt,
+		UpdatedAt:     dl.UpdatedAt,
+	}
+}
+
+// ListDeadLetters pages through entries in id order: ?status=pending&after=<id>&limit=50
+func (h *DeadLetterHandlers) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	status := query.Get("status")
+	switch status {
+	case "", repository.DeadLetterPending, repository.DeadLetterReplayed, repository.DeadLetterDiscarded:
+	default:
+		http.Error(w, "invalid status", http.StatusBadRequest)
+		return
+	}
+	after, _ := strconv.ParseInt(query.Get("after"), 10, 64)
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	letters, err := h.repo.List(r.Context(), status, after, limit)
+	if err != nil {
+		log.Printf("failed to list dead letters: %v", err)
+		http.Error(w, "Failed to list dead letters", http.StatusInternalServerError)
+		return
+	}
+
+	resp := ListDeadLettersResponse{DeadLetters: make([]DeadLetterResponse, len(letters))}
+	for i := range letters {
+		resp.DeadLetters[i] = newDeadLetterResponse(&letters[i])
+	}
+	if len(letters) == limit {
+		resp.NextAfter = letters[len(letters)-1].ID
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *DeadLetterHandlers) GetDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, ok := deadLetterID(w, r)
+	if !ok {
+		return
+	}
+	dl, err := h.repo.Get(r.Context(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "dead letter not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("failed to get dead letter %d: %v", id, err)
+		http.Error(w, "Failed to get dead letter", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, newDeadLetterResponse(dl))
+}
+
+// RetryDeadLetter republishes a pending entry. The body is optional.
+func (h *DeadLetterHandlers) RetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, ok := deadLetterID(w, r)
+	if !ok {
+		return
+	}
+	var req RetryDeadLetterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	dl, err := h.store.Retry(r.Context(), id, req.TargetTopic)
+	h.respondTransition(w, id, dl, err)
+}
+
+func (h *DeadLetterHandlers) DiscardDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, ok := deadLetterID(w, r)
+	if !ok {
+		return
+	}
+	dl, err := h.store.Discard(r.Context(), id)
+	h.respondTransition(w, id, dl, err)
+}
+
+func (h *DeadLetterHandlers) respondTransition(w http.ResponseWriter, id int64, dl *repository.DeadLetter, err error) {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "dead letter not found", http.StatusNotFound)
+	case errors.Is(err, dlq.ErrNotPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, dlq.ErrTopicNotAllowed):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case err != nil:
+		log.Printf("failed to update dead letter %d: %v", id, err)
+		http.Error(w, "Failed to update dead letter", http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusOK, newDeadLetterResponse(dl))
+	}
+}
+
+func deadLetterID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid dead letter id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -1,14 +1,20 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/its-me-ojas/event-driven-feed/internal/repository"
 )
 
+// maxFeedOffset is the deepest page offset GetFeed serves
+const maxFeedOffset = 1000
+
 type FeedResponse struct {
 	UserID  string  `json:"user_id"`
 	PostIDs []int64 `json:"post_ids"`
@@ -28,13 +34,19 @@ func (h *Handlers) GetFeed(w http.ResponseWriter, r *http.Request) {
 	if limit <= 0 || limit > 100 {
 		limit = 20
 	}
+	// offset+limit is read from both feed sources, so deep pages are capped
+	if offset < 0 || offset > maxFeedOffset {
+		http.Error(w, "offset must be between 0 and "+strconv.Itoa(maxFeedOffset), http.StatusBadRequest)
+		return
+	}
 
 	// 1. try cache first (only for page1)
 	// we usually cache the first page (offset 0) as its the most viewed
 	if offset == 0 {
 		cachedFeed, err := h.feedCache.GetFeed(r.Context(), userID)
 		if err == nil && cachedFeed != nil {
-			// Cache hit
+			// Cache hit (the processor may have grown the cached page past limit)
+			cachedFeed = cachedFeed[:min(limit, len(cachedFeed))]
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(FeedResponse{
 				UserID:  userID,
@@ -48,7 +60,7 @@ func (h *Handlers) GetFeed(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 2. cache miss - fetch from DB
-	postIDs, err := h.feedsRepo.GetFeed(r.Context(), userID, limit, offset)
+	postIDs, err := h.loadFeed(r.Context(), userID, limit, offset)
 	if err != nil {
 		http.Error(w, "Failed to get feed", http.StatusInternalServerError)
 		return
@@ -71,3 +83,60 @@ func (h *Handlers) GetFeed(w http.ResponseWriter, r *http.Request) {
 		PostIDs: postIDs,
 	})
 }
+
+// loadFeed merges the materialized feed (fan-out on write) with recent posts
+// from celebrity followees, which skip fan-out and are pulled in at read time
+func (h *Handlers) loadFeed(ctx context.Context, userID string, limit, offset int) ([]int64, error) {
+	// Both sources are read from the top so the merged page is correct for any offset
+	window := offset + limit
+
+	items, err := h.feedsRepo.GetFeed(ctx, userID, window, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	celebrities, err := h.followersRepo.GetCelebrityFollowees(ctx, userID, h.celebrityThreshold)
+	if err != nil {
+		return nil, err
+	}
+	if len(celebrities) > 0 {
+		celebrityItems, err := h.postsRepo.GetRecentFeedItems(ctx, celebrities, window)
+		if err != nil {
+			return nil, err
+		}
+		items = mergeFeedItems(items, celebrityItems)
+	}
+
+	if offset >= len(items) {
+		return nil, nil
+	}
+	items = items[offset:min(window, len(items))]
+
+	postIDs := make([]int64, len(items))
+	for i, item := range items {
+		postIDs[i] = item.PostID
+	}
+	return postIDs, nil
+}
+
+// mergeFeedItems combines two feeds newest post first, dropping duplicate posts
+// (e.g. posts fanned out before their author crossed the celebrity threshold).
+// Both sides carry posts.created_at, so the order is by post time.
+func mergeFeedItems(a, b []repository.FeedItem) []repository.FeedItem {
+	seen := make(map[int64]bool, len(a)+len(b))
+	merged := make([]repository.FeedItem, 0, len(a)+len(b))
+	for _, item := range append(a, b...) {
+		if seen[item.PostID] {
+			continue
+		}
+		seen[item.PostID] = true
+		merged = append(merged, item)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		if !merged[i].CreatedAt.Equal(merged[j].CreatedAt) {
+			return merged[i].CreatedAt.After(merged[j].CreatedAt)
+		}
+		return merged[i].PostID > merged[j].PostID
+	})
+	return merged
+}
@@ -3,6 +3,8 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/its-me-ojas/event-driven-feed/internal/events"
 )
 
 type FollowRequest struct {
@@ -11,6 +13,16 @@ type FollowRequest struct {
 }
 
 func (h *Handlers) Follow(w http.ResponseWriter, r *http.Request) {
+	h.publishFollowEvent(w, r, events.NewFollowCreatedEvent, "follow accepted")
+}
+
+func (h *Handlers) Unfollow(w http.ResponseWriter, r *http.Request) {
+	h.publishFollowEvent(w, r, events.NewFollowDeletedEvent, "unfollow accepted")
+}
+
+// publishFollowEvent validates a FollowRequest and queues the event built by newEvent.
+// The processor applies the change to followers and the follower's feed.
+func (h *Handlers) publishFollowEvent(w http.ResponseWriter, r *http.Request, newEvent func(int64, string, string) *events.Event, message string) {
 	var req FollowRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
@@ -22,11 +34,14 @@ func (h *Handlers) Follow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.followersRepo.Follow(r.Context(), req.FollowerID, req.FolloweeID); err != nil {
-		http.Error(w, "failed to follow", http.StatusInternalServerError)
+	event := newEvent(h.idGen.Generate(), req.FollowerID, req.FolloweeID)
+
+	// Keyed by followee so follow changes are ordered with the followee's posts
+	if err := h.enqueue(r.Context(), req.FolloweeID, event); err != nil {
+		http.Error(w, "failed to queue event", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"message":"followed successfully"}`))
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"message":"` + message + `"}`))
 }
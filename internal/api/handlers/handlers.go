@@ -1,28 +1,46 @@
 package handlers
 
 import (
-	"github.com/its-me-ojas/event-driven-feed/internal/kafka"
+	"context"
+
+	"github.com/its-me-ojas/event-driven-feed/internal/events"
+	"github.com/its-me-ojas/event-driven-feed/internal/outbox"
 	"github.com/its-me-ojas/event-driven-feed/internal/repository"
 	"github.com/its-me-ojas/event-driven-feed/internal/snowflake"
+	"github.com/jackc/pgx/v5"
 )
 
 type Handlers struct {
-	producer      *kafka.Producer
+	db            *repository.DB
+	outbox        *outbox.Outbox
 	idGen         *snowflake.Generator
 	postsRepo     *repository.PostsRepo
 	feedsRepo     *repository.FeedRepo
 	feedCache     *repository.FeedCache
 	followersRepo *repository.FollowersRepo
+
+	celebrityThreshold int
 }
 
 func NewHandler(
-	producer *kafka.Producer, idGen *snowflake.Generator, postsRepo *repository.PostsRepo, feedsRepo *repository.FeedRepo, feedCache *repository.FeedCache, followersRepo *repository.FollowersRepo) *Handlers {
+	db *repository.DB, outbox *outbox.Outbox, idGen *snowflake.Generator, postsRepo *repository.PostsRepo, feedsRepo *repository.FeedRepo, feedCache *repository.FeedCache, followersRepo *repository.FollowersRepo, celebrityThreshold int) *Handlers {
 	return &Handlers{
-		producer:      producer,
+		db:            db,
+		outbox:        outbox,
 		idGen:         idGen,
 		postsRepo:     postsRepo,
 		feedsRepo:     feedsRepo,
 		feedCache:     feedCache,
 		followersRepo: followersRepo,
+
+		celebrityThreshold: celebrityThreshold,
 	}
 }
+
+// enqueue stores an event in the outbox in its own transaction.
+// The outbox relay publishes it to Kafka, keyed by key.
+func (h *Handlers) enqueue(ctx context.Context, key string, event *events.Event) error {
+	return h.db.WithTx(ctx, func(tx pgx.Tx) error {
+		return h.outbox.Add(ctx, tx, key, event)
+	})
+}
@@ -2,9 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/its-me-ojas/event-driven-feed/internal/events"
+	"github.com/its-me-ojas/event-driven-feed/internal/repository"
+	"github.com/jackc/pgx/v5"
 )
 
 type CreatePostRequest struct {
@@ -17,6 +23,15 @@ type CreatePostResponse struct {
 	Message string `json:"message"`
 }
 
+type UpdatePostRequest struct {
+	AuthorID string `json:"author_id"`
+	Content  string `json:"content"`
+}
+
+type DeletePostRequest struct {
+	AuthorID string `json:"author_id"`
+}
+
 func (h *Handlers) CreatePost(w http.ResponseWriter, r *http.Request) {
 	var req CreatePostRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -33,14 +48,70 @@ func (h *Handlers) CreatePost(w http.ResponseWriter, r *http.Request) {
 	postID := h.idGen.Generate()
 
 	event := events.NewPostCreatedEvent(eventID, postID, req.AuthorID, req.Content)
-	data, err := event.Marshal()
+	post := &repository.Post{
+		PostID:    postID,
+		AuthorID:  req.AuthorID,
+		Content:   req.Content,
+		CreatedAt: time.Unix(event.Timestamp, 0),
+	}
+
+	// The post and its event commit together; the outbox relay publishes the
+	// event, so a Kafka outage delays fan-out instead of losing the post
+	err := h.db.WithTx(r.Context(), func(tx pgx.Tx) error {
+		if err := h.postsRepo.Create(r.Context(), tx, post); err != nil {
+			return err
+		}
+		return h.outbox.Add(r.Context(), tx, req.AuthorID, event)
+	})
 	if err != nil {
-		http.Error(w, "Failed to create event", http.StatusInternalServerError)
+		http.Error(w, "Failed to create post", http.StatusInternalServerError)
 		return
 	}
 
-	if err := h.producer.Publish(r.Context(), req.AuthorID, data); err != nil {
-		http.Error(w, "Failed to publish event", http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(CreatePostResponse{
+		PostID:  postID,
+		Message: "Post created successfully",
+	})
+}
+
+func (h *Handlers) UpdatePost(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdatePostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.AuthorID == "" || req.Content == "" {
+		http.Error(w, "author_id and content required", http.StatusBadRequest)
+		return
+	}
+
+	// Only the author may edit a post
+	post, err := h.postsRepo.GetByID(r.Context(), postID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "post not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get post", http.StatusInternalServerError)
+		return
+	}
+	if post.AuthorID != req.AuthorID {
+		http.Error(w, "post does not belong to author", http.StatusForbidden)
+		return
+	}
+
+	event := events.NewPostUpdatedEvent(h.idGen.Generate(), postID, post.AuthorID, req.Content)
+	// Keyed by author so edits are applied in the order they were made
+	if err := h.enqueue(r.Context(), post.AuthorID, event); err != nil {
+		http.Error(w, "Failed to queue event", http.StatusInternalServerError)
 		return
 	}
 
@@ -48,6 +119,53 @@ func (h *Handlers) CreatePost(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(CreatePostResponse{
 		PostID:  postID,
-		Message: "Post created successfully",
+		Message: "Post update accepted",
+	})
+}
+
+func (h *Handlers) DeletePost(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+
+	var req DeletePostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.AuthorID == "" {
+		http.Error(w, "author_id required", http.StatusBadRequest)
+		return
+	}
+
+	// Only the author may delete a post
+	post, err := h.postsRepo.GetByID(r.Context(), postID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "post not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get post", http.StatusInternalServerError)
+		return
+	}
+	if post.AuthorID != req.AuthorID {
+		http.Error(w, "post does not belong to author", http.StatusForbidden)
+		return
+	}
+
+	event := events.NewPostDeletedEvent(h.idGen.Generate(), postID, post.AuthorID)
+	// Keyed by author so the delete lands on the same partition as the create
+	if err := h.enqueue(r.Context(), post.AuthorID, event); err != nil {
+		http.Error(w, "Failed to queue event", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(CreatePostResponse{
+		PostID:  postID,
+		Message: "Post deletion accepted",
 	})
 }
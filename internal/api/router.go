@@ -20,8 +20,31 @@ func NewRouter(h *handlers.Handlers) *mux.Router {
 	}).Methods("GET")
 
 	r.HandleFunc("/posts", h.CreatePost).Methods("POST")
+	r.HandleFunc("/posts/{id}", h.UpdatePost).Methods("PATCH")
+	r.HandleFunc("/posts/{id}", h.DeletePost).Methods("DELETE")
 	r.HandleFunc("/feeds/{user_id}", h.GetFeed).Methods("GET")
 	r.HandleFunc("/follow", h.Follow).Methods("POST")
+	r.HandleFunc("/follow", h.Unfollow).Methods("DELETE")
+
+	return r
+}
+
+// NewAdminRouter serves the operator endpoints, kept off the public API
+func NewAdminRouter(dl *handlers.DeadLetterHandlers) *mux.Router {
+	r := mux.NewRouter()
+
+	r.Use(middleware.Logging)
+	r.Use(middleware.Recovery)
+
+	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	}).Methods("GET")
+
+	r.HandleFunc("/admin/dead-letters", dl.ListDeadLetters).Methods("GET")
+	r.HandleFunc("/admin/dead-letters/{id}", dl.GetDeadLetter).Methods("GET")
+	r.HandleFunc("/admin/dead-letters/{id}/retry", dl.RetryDeadLetter).Methods("POST")
+	r.HandleFunc("/admin/dead-letters/{id}/discard", dl.DiscardDeadLetter).Methods("POST")
 
 	return r
 }
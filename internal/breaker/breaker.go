@@ -0,0 +1,196 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned without calling the protected function while the breaker is open
+var ErrOpen = errors.New("circuit breaker open")
+
+type State int
+
+const (
+	Closed   State = iota // calls pass through
+	HalfOpen              // one probe call is let through to test recovery
+	Open                  // calls fail fast with ErrOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	}
+	return "unknown"
+}
+
+type Config struct {
+	FailureThreshold int           // consecutive failures that open the breaker
+	OpenTimeout      time.Duration // how long to stay open before probing
+
+	// IsFailure decides whether an error counts against the dependency.
+	// Defaults to any non-nil error.
+	IsFailure func(err error) bool
+
+	// Probe checks the dependency while the breaker is open, so Wait can
+	// close it without needing real traffic. Optional.
+	Probe func(ctx context.Context) error
+
+	// OnStateChange is called after every transition, e.g. to export a gauge
+	OnStateChange func(state State)
+}
+
+// DefaultConfig opens after 5 consecutive failures and probes every 10s
+var DefaultConfig = Config{
+	FailureThreshold: 5,
+	OpenTimeout:      10 * time.Second,
+}
+
+// Breaker stops calls to a dependency that keeps failing, then lets a single
+// probe through after OpenTimeout and closes again once it succeeds.
+type Breaker struct {
+	cfg Config
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func New(cfg Config) *Breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = DefaultConfig.FailureThreshold
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = DefaultConfig.OpenTimeout
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = func(err error) bool { return err != nil }
+	}
+	b := &Breaker{cfg: cfg}
+	if cfg.OnStateChange != nil {
+		cfg.OnStateChange(Closed)
+	}
+	return b
+}
+
+// State returns the current state
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Do runs fn unless the breaker is open, and records its outcome
+func (b *Breaker) Do(fn func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.record(err)
+	return err
+}
+
+// Wait blocks while the breaker is open. Once OpenTimeout has passed it
+// probes the dependency (if a Probe is configured) and returns when the
+// breaker lets calls through again. Returns ctx.Err() if ctx ends first.
+func (b *Breaker) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		state, remaining := b.state, b.cfg.OpenTimeout-time.Since(b.openedAt)
+		b.mu.Unlock()
+
+		if state != Open {
+			return nil
+		}
+		if remaining > 0 {
+			t := time.NewTimer(remaining)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			case <-t.C:
+			}
+			continue
+		}
+		if b.cfg.Probe == nil {
+			// No probe: let the next real call test the dependency
+			return nil
+		}
+		b.Do(func() error { return b.cfg.Probe(ctx) })
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.cfg.OpenTimeout {
+			return ErrOpen
+		}
+		b.setState(HalfOpen)
+		b.probing = true
+		return nil
+	case HalfOpen:
+		// Only one probe at a time
+		if b.probing {
+			return ErrOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failed := b.cfg.IsFailure(err)
+	if b.state == HalfOpen {
+		b.probing = false
+		if failed {
+			b.trip()
+		} else {
+			b.failures = 0
+			b.setState(Closed)
+		}
+		return
+	}
+
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == Closed && b.failures >= b.cfg.FailureThreshold {
+		b.trip()
+	}
+}
+
+func (b *Breaker) trip() {
+	b.openedAt = time.Now()
+	b.setState(Open)
+}
+
+// setState must be called with mu held
+func (b *Breaker) setState(s State) {
+	if b.state == s {
+		return
+	}
+	b.state = s
+	if b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(s)
+	}
+}
@@ -0,0 +1,197 @@
+package dlq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	feedkafka "github.com/its-me-ojas/event-driven-feed/internal/kafka"
+	"github.com/its-me-ojas/event-driven-feed/internal/repository"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/segmentio/kafka-go"
+)
+
+// sinkGroup is the consumer group the sink commits its DLQ offsets under
+const sinkGroup = "dlq-sink"
+
+// Sink copies every message on the DLQ topic into the dead_letters table.
+// Offsets are committed only once a message is stored, so nothing expires
+// from Kafka before it reaches Postgres.
+type Sink struct {
+	reader *kafka.Reader
+	repo   *repository.DeadLetterRepo
+}
+
+func NewSink(brokers []string, topic string, repo *repository.DeadLetterRepo) *Sink {
+	return &Sink{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     brokers,
+			Topic:       topic,
+			GroupID:     sinkGroup,
+			StartOffset: kafka.FirstOffset,
+		}),
+		repo: repo,
+	}
+}
+
+// Run stores messages until ctx is cancelled
+func (s *Sink) Run(ctx context.Context) {
+	fetchBackoff := 100 * time.Millisecond
+	for {
+		m, err := s.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("DLQ sink fetch error (backing off %v): %v", fetchBackoff, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(fetchBackoff):
+			}
+			fetchBackoff = min(fetchBackoff*2, 30*time.Second)
+			continue
+		}
+		// Reset backoff on success
+		fetchBackoff = 100 * time.Millisecond
+
+		if !s.store(ctx, m) {
+			return
+		}
+		if err := s.reader.CommitMessages(ctx, m); err != nil && ctx.Err() == nil {
+			log.Printf("DLQ sink commit error: %v", err)
+		}
+	}
+}
+
+// store inserts m, backing off while Postgres is failing. A row Postgres
+// rejects outright (e.g. a NUL byte in the error text) is tried again cleaned,
+// then as a placeholder pointing at the DLQ offset, and is dropped with a log
+// line if even that fails, so one bad message can't hold up the ones behind
+// it until they expire from Kafka. It only gives up (returning false) when
+// ctx is cancelled.
+func (s *Sink) store(ctx context.Context, m kafka.Message) bool {
+	dl := toDeadLetter(m)
+	fallbacks := []func(dl *repository.DeadLetter, err error) *repository.DeadLetter{cleaned, placeholder}
+	backoff := time.Second
+	for {
+		_, err := s.repo.Insert(ctx, dl)
+		if err == nil {
+			return true
+		}
+		if rejected(err) {
+			if len(fallbacks) == 0 {
+				log.Printf("DLQ sink dropping offset %d/%d, Postgres rejects even a placeholder: %v", m.Partition, m.Offset, err)
+				return true
+			}
+			log.Printf("DLQ sink could not store offset %d/%d as is, storing a fallback: %v", m.Partition, m.Offset, err)
+			dl, fallbacks = fallbacks[0](dl, err), fallbacks[1:]
+			continue
+		}
+		log.Printf("DLQ sink failed to store offset %d/%d, retrying in %v: %v", m.Partition, m.Offset, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+// rejected reports errors Postgres raises for the row itself (class 22: data
+// exception, class 23: integrity violation), which no retry can fix
+func rejected(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23"))
+}
+
+// cleaned copies dl with its text made storable: valid UTF-8 without NUL
+// bytes (TEXT and JSONB reject them) and cut to the column widths. The key
+// and payload are BYTEA and kept as they are.
+func cleaned(dl *repository.DeadLetter, _ error) *repository.DeadLetter {
+	c := *dl
+	c.Headers = make([]repository.DeadLetterHeader, len(dl.Headers))
+	for i, h := range dl.Headers {
+		c.Headers[i] = repository.DeadLetterHeader{Key: cleanText(h.Key, 0), Value: cleanText(h.Value, 0)}
+	}
+	c.OriginalTopic = cleanText(dl.OriginalTopic, 255)
+	c.Error = cleanText(dl.Error, 0)
+	c.ErrorReason = cleanText(dl.ErrorReason, 64)
+	return &c
+}
+
+// placeholder keeps only what identifies the message, so it shows up in the
+// admin API and can be looked up on the DLQ topic
+func placeholder(dl *repository.DeadLetter, err error) *repository.DeadLetter {
+	return &repository.DeadLetter{
+		Topic:     dl.Topic,
+		Partition: dl.Partition,
+		Offset:    dl.Offset,
+		Payload:   []byte{},
+		Headers:   []repository.DeadLetterHeader{},
+		Error:     cleanText(fmt.Sprintf("not stored, read partition %d offset %d of %s: %v", dl.Partition, dl.Offset, dl.Topic, err), 0),
+		Attempts:  dl.Attempts,
+	}
+}
+
+// cleanText replaces invalid UTF-8, drops NUL bytes and, if limit > 0, keeps at
+// most limit characters
+func cleanText(s string, limit int) string {
+	s = strings.ReplaceAll(strings.ToValidUTF8(s, "\uFFFD"), "\x00", "")
+	if r := []rune(s); limit > 0 && len(r) > limit {
+		s = string(r[:limit])
+	}
+	return s
+}
+
+func (s *Sink) Close() error {
+	return s.reader.Close()
+}
+
+// toDeadLetter maps a DLQ message and its failure headers to a row
+func toDeadLetter(m kafka.Message) *repository.DeadLetter {
+	dl := &repository.DeadLetter{
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Key:       m.Key,
+		Payload:   m.Value,
+		Headers:   make([]repository.DeadLetterHeader, len(m.Headers)),
+		Attempts:  1,
+	}
+	counted, tiers := false, 0
+	for i, h := range m.Headers {
+		dl.Headers[i] = repository.DeadLetterHeader{Key: h.Key, Value: string(h.Value)}
+
+		switch h.Key {
+		case feedkafka.HeaderOriginalTopic:
+			dl.OriginalTopic = string(h.Value)
+		case feedkafka.HeaderError:
+			dl.Error = string(h.Value)
+		case feedkafka.HeaderErrorReason:
+			dl.ErrorReason = string(h.Value)
+		case feedkafka.HeaderFailedAt:
+			if t, err := time.Parse(time.RFC3339, string(h.Value)); err == nil {
+				dl.FailedAt = &t
+			}
+		case feedkafka.HeaderAttempts:
+			if n, err := strconv.Atoi(string(h.Value)); err == nil {
+				dl.Attempts = n
+				counted = true
+			}
+		case feedkafka.HeaderRetryAttempt:
+			tiers, _ = strconv.Atoi(string(h.Value))
+		}
+	}
+	// Dead letters from before the attempts header: count passes through the
+	// retry tiers, plus the first pass on the main topic
+	if !counted {
+		dl.Attempts = tiers + 1
+	}
+	return dl
+}
@@ -0,0 +1,102 @@
+package dlq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	feedkafka "github.com/its-me-ojas/event-driven-feed/internal/kafka"
+	"github.com/its-me-ojas/event-driven-feed/internal/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrNotPending is returned when acting on an entry already replayed or discarded
+var ErrNotPending = errors.New("dead letter is not pending")
+
+// ErrTopicNotAllowed is returned when retrying into a topic that is neither
+// the entry's original topic nor one of the configured replay topics
+var ErrTopicNotAllowed = errors.New("target topic is not allowed")
+
+// Store retries and discards stored dead letters
+type Store struct {
+	db           *repository.DB
+	repo         *repository.DeadLetterRepo
+	writer       *kafka.Writer
+	replayTopics map[string]bool // allowed targets besides the original topic
+}
+
+func NewStore(db *repository.DB, repo *repository.DeadLetterRepo, writer *kafka.Writer, replayTopics []string) *Store {
+	allowed := make(map[string]bool, len(replayTopics))
+	for _, topic := range replayTopics {
+		allowed[topic] = true
+	}
+	return &Store{db: db, repo: repo, writer: writer, replayTopics: allowed}
+}
+
+// Retry republishes a pending entry, to targetTopic if set and otherwise to
+// its original topic, and marks it replayed. targetTopic must be the original
+// topic or one of the replay topics, else ErrTopicNotAllowed is returned. The row stays locked while the
+// message is written; if the commit fails after the write the entry stays
+// pending and a second retry sends a duplicate, which the processor's
+// idempotency absorbs.
+func (s *Store) Retry(ctx context.Context, id int64, targetTopic string) (*repository.DeadLetter, error) {
+	return s.transition(ctx, id, repository.DeadLetterReplayed, func(dl *repository.DeadLetter) error {
+		if targetTopic != "" && targetTopic != dl.OriginalTopic && !s.replayTopics[targetTopic] {
+			return fmt.Errorf("%w: %s", ErrTopicNotAllowed, targetTopic)
+		}
+		if err := feedkafka.ReplayMessage(ctx, s.writer, toMessage(dl), targetTopic); err != nil {
+			return fmt.Errorf("replay dead letter %d: %w", dl.ID, err)
+		}
+		return nil
+	})
+}
+
+// Discard marks a pending entry as deliberately dropped
+func (s *Store) Discard(ctx context.Context, id int64) (*repository.DeadLetter, error) {
+	return s.transition(ctx, id, repository.DeadLetterDiscarded, nil)
+}
+
+// transition moves a pending entry to status, running fn first with the row locked
+func (s *Store) transition(ctx context.Context, id int64, status string, fn func(dl *repository.DeadLetter) error) (*repository.DeadLetter, error) {
+	var dl *repository.DeadLetter
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		if dl, err = s.repo.GetForUpdate(ctx, tx, id); err != nil {
+			return err
+		}
+		if dl.Status != repository.DeadLetterPending {
+			return ErrNotPending
+		}
+		if fn != nil {
+			if err := fn(dl); err != nil {
+				return err
+			}
+		}
+		if err := s.repo.SetStatus(ctx, tx, id, status); err != nil {
+			return fmt.Errorf("set status: %w", err)
+		}
+		dl.Status = status
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dl, nil
+}
+
+// toMessage rebuilds the DLQ message from a stored entry
+func toMessage(dl *repository.DeadLetter) kafka.Message {
+	m := kafka.Message{
+		Topic:     dl.Topic,
+		Partition: dl.Partition,
+		Offset:    dl.Offset,
+		Key:       dl.Key,
+		Value:     dl.Payload,
+		Headers:   make([]kafka.Header, len(dl.Headers)),
+	}
+	for i, h := range dl.Headers {
+		m.Headers[i] = kafka.Header{Key: h.Key, Value: []byte(h.Value)}
+	}
+	return m
+}
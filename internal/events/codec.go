@@ -0,0 +1,189 @@
+package events
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ContentTypeHeader is the Kafka header that names the codec used for a message value
+const ContentTypeHeader = "content-type"
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// Codec encodes events for the wire
+type Codec interface {
+	ContentType() string
+	Encode(e *Event) ([]byte, error)
+	Decode(data []byte) (*Event, error)
+}
+
+var (
+	JSONCodec     Codec = jsonCodec{}
+	ProtobufCodec Codec = protobufCodec{}
+)
+
+// CodecFor returns the codec for a content-type header value.
+// Messages without the header predate codecs and are JSON.
+func CodecFor(contentType string) (Codec, error) {
+	switch contentType {
+	case "", ContentTypeJSON:
+		return JSONCodec, nil
+	case ContentTypeProtobuf:
+		return ProtobufCodec, nil
+	default:
+		return nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+}
+
+// CodecByName maps a config value ("json" or "protobuf") to a codec
+func CodecByName(name string) (Codec, error) {
+	switch name {
+	case "", "json":
+		return JSONCodec, nil
+	case "protobuf", "proto":
+		return ProtobufCodec, nil
+	default:
+		return nil, fmt.Errorf("unknown event encoding %q", name)
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                { return ContentTypeJSON }
+func (jsonCodec) Encode(e *Event) ([]byte, error)    { return e.Marshal() }
+func (jsonCodec) Decode(data []byte) (*Event, error) { return Unmarshal(data) }
+
+// protobufCodec encodes the layout described in event.proto
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return ContentTypeProtobuf }
+
+func (protobufCodec) Encode(e *Event) ([]byte, error) {
+	var b []byte
+	b = appendVarint(b, 1, uint64(e.SchemaVersion))
+	b = appendVarint(b, 2, uint64(e.EventID))
+	b = appendString(b, 3, e.Type)
+	b = appendString(b, 4, e.ActorID)
+
+	var p []byte
+	p = appendVarint(p, 1, uint64(e.Payload.PostID))
+	p = appendString(p, 2, e.Payload.Content)
+	p = appendString(p, 3, e.Payload.FolloweeID)
+	if len(p) > 0 {
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendBytes(b, p)
+	}
+
+	b = appendVarint(b, 6, uint64(e.Timestamp))
+	return b, nil
+}
+
+func (protobufCodec) Decode(data []byte) (*Event, error) {
+	var e Event
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			e.SchemaVersion = int(v)
+			return n, nil
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			e.EventID = int64(v)
+			return n, nil
+		case num == 3 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			e.Type = v
+			return n, nil
+		case num == 4 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			e.ActorID = v
+			return n, nil
+		case num == 5 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			return n, decodePayload(v, &e.Payload)
+		case num == 6 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			e.Timestamp = int64(v)
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Protobuf evolves through field numbers, so older versions decode as-is.
+	// Only a newer producer can write something we might misread.
+	if e.SchemaVersion > CurrentSchemaVersion {
+		return nil, &UnsupportedVersionError{Version: e.SchemaVersion, Current: CurrentSchemaVersion}
+	}
+	e.SchemaVersion = CurrentSchemaVersion
+	return &e, nil
+}
+
+func decodePayload(data []byte, p *Payload) error {
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			p.PostID = int64(v)
+			return n, nil
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			p.Content = v
+			return n, nil
+		case num == 3 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			p.FolloweeID = v
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+}
+
+// consumeFields walks a protobuf message, handing each field's value bytes to fn.
+// fn returns how many bytes it consumed (negative on a malformed value).
+func consumeFields(data []byte, fn func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return fmt.Errorf("protobuf decode: %v", protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		m, err := fn(num, typ, data)
+		if err != nil {
+			return err
+		}
+		if m < 0 {
+			return fmt.Errorf("protobuf decode field %d: %v", num, protowire.ParseError(m))
+		}
+		data = data[m:]
+	}
+	return nil
+}
+
+// proto3 omits zero values, so these helpers skip them too
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
@@ -0,0 +1,62 @@
+package events
+
+import "testing"
+
+// sampleEvents has one event of every type, with IDs above 2^53 and
+// non-ASCII content so varint and string encoding mistakes show up
+func sampleEvents() []*Event {
+	const eventID, postID = int64(105000000000000001), int64(105000000000000003)
+	return []*Event{
+		NewPostCreatedEvent(eventID, postID, "user-1", "hello, wörld 👋"),
+		NewPostDeletedEvent(eventID+1, postID, "user-1"),
+		NewPostUpdatedEvent(eventID+2, postID, "user-1", "edited"),
+		NewFollowCreatedEvent(eventID+3, "user-2", "user-1"),
+		NewFollowDeletedEvent(eventID+4, "user-2", "user-1"),
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, name := range []string{"json", "protobuf"} {
+		codec, err := CodecByName(name)
+		if err != nil {
+			t.Fatalf("CodecByName(%q): %v", name, err)
+		}
+		for _, want := range sampleEvents() {
+			data, err := codec.Encode(want)
+			if err != nil {
+				t.Fatalf("%s: encode %s: %v", name, want.Type, err)
+			}
+			got, err := codec.Decode(data)
+			if err != nil {
+				t.Fatalf("%s: decode %s: %v", name, want.Type, err)
+			}
+			if *got != *want {
+				t.Errorf("%s: %s round trip = %+v, want %+v", name, want.Type, *got, *want)
+			}
+		}
+	}
+}
+
+func TestCodecFor(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        Codec
+	}{
+		{"", JSONCodec}, // messages from before codecs had no header
+		{ContentTypeJSON, JSONCodec},
+		{ContentTypeProtobuf, ProtobufCodec},
+	}
+	for _, tt := range tests {
+		got, err := CodecFor(tt.contentType)
+		if err != nil {
+			t.Fatalf("CodecFor(%q): %v", tt.contentType, err)
+		}
+		if got != tt.want {
+			t.Errorf("CodecFor(%q) = %s, want %s", tt.contentType, got.ContentType(), tt.want.ContentType())
+		}
+	}
+
+	if _, err := CodecFor("text/plain"); err == nil {
+		t.Error("CodecFor(text/plain) succeeded, want an error")
+	}
+}
@@ -0,0 +1,63 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EventTypeFeedUpdated is published on the feed-events topic after a post
+// has been fanned out, for downstream consumers (notifications, cache
+// warmers, analytics) that would otherwise poll Postgres
+const EventTypeFeedUpdated = "FEED_UPDATED"
+
+// FeedEventSchemaVersion versions FeedUpdatedEvent independently of Event
+const FeedEventSchemaVersion = 1
+
+// FeedUpdatedEvent reports one fan-out chunk of a post: the users whose feeds
+// now contain it. A post fans out in one or more chunks; the last one has
+// Final set. Celebrity posts skip fan-out and are reported once with
+// FanoutOnRead set and no recipients. SourceEventID plus Chunk identify an
+// update, so consumers can drop redeliveries.
+type FeedUpdatedEvent struct {
+	SchemaVersion int      `json:"schema_version"`
+	Type          string   `json:"type"`
+	SourceEventID int64    `json:"source_event_id"` // the POST_CREATED event that was fanned out
+	PostID        int64    `json:"post_id"`
+	AuthorID      string   `json:"author_id"`
+	RecipientIDs  []string `json:"recipient_ids,omitempty"`
+	Chunk         int      `json:"chunk"` // 0-based
+	Final         bool     `json:"final"`
+	FanoutOnRead  bool     `json:"fanout_on_read,omitempty"`
+	Timestamp     int64    `json:"timestamp"`
+}
+
+func NewFeedUpdatedEvent(sourceEventID, postID int64, authorID string, recipientIDs []string, chunk int, final bool) *FeedUpdatedEvent {
+	return &FeedUpdatedEvent{
+		SchemaVersion: FeedEventSchemaVersion,
+		Type:          EventTypeFeedUpdated,
+		SourceEventID: sourceEventID,
+		PostID:        postID,
+		AuthorID:      authorID,
+		RecipientIDs:  recipientIDs,
+		Chunk:         chunk,
+		Final:         final,
+		Timestamp:     time.Now().Unix(),
+	}
+}
+
+func (e *FeedUpdatedEvent) Marshal() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// UnmarshalFeedUpdated decodes a feed-events message. Events from a newer
+// schema are rejected with *UnsupportedVersionError.
+func UnmarshalFeedUpdated(data []byte) (*FeedUpdatedEvent, error) {
+	var event FeedUpdatedEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	if event.SchemaVersion > FeedEventSchemaVersion {
+		return nil, &UnsupportedVersionError{Version: event.SchemaVersion, Current: FeedEventSchemaVersion}
+	}
+	return &event, nil
+}
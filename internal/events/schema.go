@@ -8,28 +8,80 @@ import (
 const (
 	EventTypePostCreated = "POST_CREATED"
 	EventTypePostDeleted = "POST_DELETED"
+	EventTypePostUpdated = "POST_UPDATED"
+
+	EventTypeFollowCreated = "FOLLOW_CREATED"
+	EventTypeFollowDeleted = "FOLLOW_DELETED"
 )
 
 type Event struct {
-	EventID   int64   `json:"event_id"`
-	Type      string  `json:"type"`
-	ActorID   string  `json:"actor_id"`
-	Payload   Payload `json:"payload"`
-	Timestamp int64   `json:"timestamp"`
+	SchemaVersion int     `json:"schema_version"`
+	EventID       int64   `json:"event_id"`
+	Type          string  `json:"type"`
+	ActorID       string  `json:"actor_id"`
+	Payload       Payload `json:"payload"`
+	Timestamp     int64   `json:"timestamp"`
 }
 
 type Payload struct {
-	PostID  int64  `json:"post_id,omitempty"`
-	Content string `json:"content,omitempty"`
+	PostID     int64  `json:"post_id,omitempty"`
+	Content    string `json:"content,omitempty"`
+	FolloweeID string `json:"followee_id,omitempty"`
 }
 
 func NewPostCreatedEvent(eventID, postID int64, authodID, content string) *Event {
 	return &Event{
-		EventID:   eventID,
-		Type:      EventTypePostCreated,
-		ActorID:   authodID,
-		Payload:   Payload{PostID: postID, Content: content},
-		Timestamp: time.Now().Unix(),
+		SchemaVersion: CurrentSchemaVersion,
+		EventID:       eventID,
+		Type:          EventTypePostCreated,
+		ActorID:       authodID,
+		Payload:       Payload{PostID: postID, Content: content},
+		Timestamp:     time.Now().Unix(),
+	}
+}
+
+func NewPostDeletedEvent(eventID, postID int64, authorID string) *Event {
+	return &Event{
+		SchemaVersion: CurrentSchemaVersion,
+		EventID:       eventID,
+		Type:          EventTypePostDeleted,
+		ActorID:       authorID,
+		Payload:       Payload{PostID: postID},
+		Timestamp:     time.Now().Unix(),
+	}
+}
+
+func NewPostUpdatedEvent(eventID, postID int64, authorID, content string) *Event {
+	return &Event{
+		SchemaVersion: CurrentSchemaVersion,
+		EventID:       eventID,
+		Type:          EventTypePostUpdated,
+		ActorID:       authorID,
+		Payload:       Payload{PostID: postID, Content: content},
+		Timestamp:     time.Now().Unix(),
+	}
+}
+
+// Follow events use the follower as the actor
+func NewFollowCreatedEvent(eventID int64, followerID, followeeID string) *Event {
+	return &Event{
+		SchemaVersion: CurrentSchemaVersion,
+		EventID:       eventID,
+		Type:          EventTypeFollowCreated,
+		ActorID:       followerID,
+		Payload:       Payload{FolloweeID: followeeID},
+		Timestamp:     time.Now().Unix(),
+	}
+}
+
+func NewFollowDeletedEvent(eventID int64, followerID, followeeID string) *Event {
+	return &Event{
+		SchemaVersion: CurrentSchemaVersion,
+		EventID:       eventID,
+		Type:          EventTypeFollowDeleted,
+		ActorID:       followerID,
+		Payload:       Payload{FolloweeID: followeeID},
+		Timestamp:     time.Now().Unix(),
 	}
 }
 
@@ -37,7 +89,26 @@ func (e *Event) Marshal() ([]byte, error) {
 	return json.Marshal(e)
 }
 
+// Unmarshal decodes an event, upgrading older schema versions to the current
+// struct. Events from a newer schema are rejected with *UnsupportedVersionError.
 func Unmarshal(data []byte) (*Event, error) {
+	var probe struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+	if probe.SchemaVersion > CurrentSchemaVersion {
+		return nil, &UnsupportedVersionError{Version: probe.SchemaVersion, Current: CurrentSchemaVersion}
+	}
+	if probe.SchemaVersion < CurrentSchemaVersion {
+		upgraded, err := upcast(data, probe.SchemaVersion)
+		if err != nil {
+			return nil, err
+		}
+		data = upgraded
+	}
+
 	var event Event
 	if err := json.Unmarshal(data, &event); err != nil {
 		return nil, err
@@ -0,0 +1,77 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// CurrentSchemaVersion is the envelope version written by this build.
+// Bump it and register an upcaster from the previous version whenever
+// the shape of Event or Payload changes.
+const CurrentSchemaVersion = 1
+
+// Upcaster converts a raw event from one schema version to the next.
+// It works on the decoded JSON object so it can read fields the current
+// structs no longer have. Numbers arrive as json.Number so 64-bit IDs
+// keep their precision.
+type Upcaster func(raw map[string]any) (map[string]any, error)
+
+// UnsupportedVersionError is returned by Unmarshal for events written by a
+// newer producer than this build understands
+type UnsupportedVersionError struct {
+	Version int
+	Current int
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("unsupported event schema version %d (current %d)", e.Version, e.Current)
+}
+
+var (
+	upcastersMu sync.RWMutex
+	upcasters   = map[int]Upcaster{}
+)
+
+// RegisterUpcaster registers the function that upgrades events at fromVersion to fromVersion+1
+func RegisterUpcaster(fromVersion int, fn Upcaster) {
+	upcastersMu.Lock()
+	defer upcastersMu.Unlock()
+	upcasters[fromVersion] = fn
+}
+
+func init() {
+	// Version 0: events produced before the envelope carried schema_version.
+	// The fields are identical, so the upgrade only stamps the version.
+	RegisterUpcaster(0, func(raw map[string]any) (map[string]any, error) {
+		return raw, nil
+	})
+}
+
+// upcast walks the registered upcasters from version up to CurrentSchemaVersion
+func upcast(data []byte, version int) ([]byte, error) {
+	// UseNumber: snowflake IDs don't survive a round trip through float64
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	upcastersMu.RLock()
+	defer upcastersMu.RUnlock()
+
+	for v := version; v < CurrentSchemaVersion; v++ {
+		fn, ok := upcasters[v]
+		if !ok {
+			return nil, fmt.Errorf("no upcaster registered for schema version %d", v)
+		}
+		var err error
+		if raw, err = fn(raw); err != nil {
+			return nil, fmt.Errorf("upcast from version %d: %v", v, err)
+		}
+		raw["schema_version"] = v + 1
+	}
+	return json.Marshal(raw)
+}
@@ -0,0 +1,26 @@
+package events
+
+import "testing"
+
+func TestUnmarshalV0KeepsLargeIDs(t *testing.T) {
+	// Above 2^53, so a float64 round trip would change them
+	const eventID, postID = int64(105000000000000001), int64(105000000000000003)
+
+	// v0 events predate schema_version
+	data := []byte(`{"event_id":105000000000000001,"type":"POST_CREATED","actor_id":"user-1",` +
+		`"payload":{"post_id":105000000000000003,"content":"hi"},"timestamp":1700000000}`)
+
+	event, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if event.SchemaVersion != CurrentSchemaVersion {
+		t.Errorf("schema version = %d, want %d", event.SchemaVersion, CurrentSchemaVersion)
+	}
+	if event.EventID != eventID {
+		t.Errorf("event_id = %d, want %d", event.EventID, eventID)
+	}
+	if event.Payload.PostID != postID {
+		t.Errorf("post_id = %d, want %d", event.Payload.PostID, postID)
+	}
+}
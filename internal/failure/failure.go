@@ -0,0 +1,105 @@
+package failure
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Kind tells the consumer what to do with a failed message
+type Kind int
+
+const (
+	// Retryable failures may succeed on another attempt (the default for untyped errors)
+	Retryable Kind = iota
+	// Permanent failures can never succeed and go straight to the DLQ
+	Permanent
+	// Throttled failures mean a dependency is overloaded; the consumer pauses
+	// the partition and tries again without spending a retry attempt
+	Throttled
+	// Unhandled failures mean no handler is registered for the event type;
+	// the consumer parks the message until a processor that knows it is deployed
+	Unhandled
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Permanent:
+		return "permanent"
+	case Throttled:
+		return "throttled"
+	case Unhandled:
+		return "unhandled"
+	default:
+		return "retryable"
+	}
+}
+
+// Reason codes recorded in the DLQ error-reason header
+const (
+	ReasonDecode            = "decode_error"
+	ReasonUnsupportedSchema = "unsupported_schema"
+	ReasonInvalidData       = "invalid_data"
+	ReasonRetriesExhausted  = "retries_exhausted"
+	ReasonUnknownEventType  = "unknown_event_type"
+)
+
+// Error wraps a handler error with its kind
+type Error struct {
+	Kind       Kind
+	Reason     string        // short machine-readable code, set for permanent and unhandled errors
+	RetryAfter time.Duration // how long to pause, set for throttled errors
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("%s (%s): %v", e.Kind, e.Reason, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func NewRetryable(err error) error {
+	return &Error{Kind: Retryable, Err: err}
+}
+
+func NewPermanent(reason string, err error) error {
+	return &Error{Kind: Permanent, Reason: reason, Err: err}
+}
+
+func NewThrottled(retryAfter time.Duration, err error) error {
+	return &Error{Kind: Throttled, RetryAfter: retryAfter, Err: err}
+}
+
+func NewUnhandled(err error) error {
+	return &Error{Kind: Unhandled, Reason: ReasonUnknownEventType, Err: err}
+}
+
+// KindOf returns the kind of err. Untyped errors are retryable.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return Retryable
+}
+
+// ReasonOf returns the reason code of a permanent error, or ""
+func ReasonOf(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Reason
+	}
+	return ""
+}
+
+// RetryAfterOf returns how long a throttled error asked to wait, or 0
+func RetryAfterOf(err error) time.Duration {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.RetryAfter
+	}
+	return 0
+}
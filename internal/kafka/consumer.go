@@ -3,31 +3,93 @@ package kafka
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"os"
+	"runtime/debug"
+	"sync"
 	"time"
 
+	"github.com/its-me-ojas/event-driven-feed/internal/breaker"
+	"github.com/its-me-ojas/event-driven-feed/internal/failure"
+	"github.com/its-me-ojas/event-driven-feed/internal/retry"
 	"github.com/segmentio/kafka-go"
 )
 
+// workerQueueSize bounds how many messages can wait on one worker
+// before fetching blocks (backpressure)
+const workerQueueSize = 64
+
+// partitionBufferSize bounds how many fetched messages a paused (or not yet
+// due) partition holds before fetching blocks for every partition
+const partitionBufferSize = 1024
+
+// maxThrottlePauses bounds how many times a throttled message pauses its
+// partition before it is treated as failed and moves to the next retry tier
+// or the DLQ
+const maxThrottlePauses = 10
+
+// batchLinger is how long a batch waits for more messages after the first one arrives
+const batchLinger = 50 * time.Millisecond
+
 type Consumer struct {
-	reader     *kafka.Reader
-	dlqWriter  *kafka.Writer // Dead letter queue
-	maxRetries int
+	reader      *kafka.Reader
+	dlqWriter   *kafka.Writer // Dead letter queue
+	retryWriter *kafka.Writer // Publishes to the retry tiers (topic set per message)
+	parkWriter  *kafka.Writer // Parking topic for unknown event types
+	retry       retry.Policy  // in-loop attempts per message
+	workers     int
+	batchSize   int
+	pauses      *partitionPauses
+	breaker     *breaker.Breaker // fetching stops while it is open (nil = never)
+
+	// Stamped on dead letters
+	groupID string
+	host    string
+	version string
+
+	tiers []retryTier // retry chain, empty when retries happen in-loop
+	tier  int         // index of the tier this consumer reads, -1 for the main topic
 }
 
 type ConsumerConfig struct {
-	Brokers    []string
-	Topic      string
-	GroupID    string
-	DLQTopic   string // dead letter topic
-	MaxRetries int    // Max retries before DLQ
+	Brokers      []string
+	Topic        string
+	GroupID      string
+	DLQTopic     string           // dead letter topic
+	ParkingTopic string           // unknown event types wait here to be re-injected
+	Retry        retry.Policy     // In-loop attempts before DLQ (a single attempt when RetryDelays is set)
+	RetryDelays  []time.Duration  // Delay of each retry topic, e.g. 1s, 30s, 5m
+	Workers      int              // Messages are hashed by key to this many workers
+	BatchSize    int              // Max messages per batch in ConsumeBatchLoop
+	Breaker      *breaker.Breaker // Stop fetching while the handler's database is down
+	Version      string           // Build stamped on dead letters (default: the module version)
 }
 
+// NewConsumer creates a consumer for the main topic. With RetryDelays set,
+// failed messages move to the first retry topic instead of blocking the
+// partition; run NewRetryConsumers alongside it to drain the chain.
 func NewConsumer(cfg ConsumerConfig) *Consumer {
+	return newConsumer(cfg, cfg.Topic, cfg.GroupID, -1)
+}
+
+// NewRetryConsumers creates one consumer per retry topic. Each holds messages
+// until they are due, re-runs the handler, and passes failures down the
+// chain; messages that exhaust the last tier go to the DLQ.
+func NewRetryConsumers(cfg ConsumerConfig) []*Consumer {
+	tiers := retryTiers(cfg.Topic, cfg.RetryDelays)
+	consumers := make([]*Consumer, len(tiers))
+	for i, t := range tiers {
+		consumers[i] = newConsumer(cfg, t.topic, cfg.GroupID+"-retry-"+shortDuration(t.delay), i)
+	}
+	return consumers
+}
+
+func newConsumer(cfg ConsumerConfig, topic, groupID string, tier int) *Consumer {
 	r := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:        cfg.Brokers,
-		GroupID:        cfg.GroupID,
-		Topic:          cfg.Topic,
+		GroupID:        groupID,
+		Topic:          topic,
 		MinBytes:       10e3,
 		MaxBytes:       10e6,
 		CommitInterval: 0,
@@ -43,15 +105,71 @@ func NewConsumer(cfg ConsumerConfig) *Consumer {
 		}
 	}
 
-	maxRetries := cfg.MaxRetries
-	if maxRetries <= 0 {
-		maxRetries = 3
+	// Parking producer
+	var parkWriter *kafka.Writer
+	if cfg.ParkingTopic != "" {
+		parkWriter = &kafka.Writer{
+			Addr:  kafka.TCP(cfg.Brokers...),
+			Topic: cfg.ParkingTopic,
+		}
+	}
+
+	// Retry tier producer (hash balancer keeps a key's retries in order)
+	var retryWriter *kafka.Writer
+	if len(cfg.RetryDelays) > 0 {
+		retryWriter = &kafka.Writer{
+			Addr:     kafka.TCP(cfg.Brokers...),
+			Balancer: &kafka.Hash{},
+		}
+	}
+
+	policy := cfg.Retry
+	if policy.MaxRetries <= 0 {
+		policy = retry.DefaultPolicy
+	}
+	// With a retry chain, one attempt here; the delay topics do the rest
+	if len(cfg.RetryDelays) > 0 {
+		policy.MaxRetries = 1
+	}
+	onRetry := policy.OnRetry
+	policy.OnRetry = func(attempt int, err error, wait time.Duration) {
+		log.Printf("Handler error (attempt %d/%d, retrying in %v): %v", attempt, policy.MaxRetries, wait.Round(time.Millisecond), err)
+		if onRetry != nil {
+			onRetry(attempt, err, wait)
+		}
 	}
 
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	version := cfg.Version
+	if version == "" {
+		version = buildVersion()
+	}
+	host, _ := os.Hostname()
+
 	return &Consumer{
-		reader:     r,
-		dlqWriter:  dlq,
-		maxRetries: maxRetries,
+		reader:      r,
+		dlqWriter:   dlq,
+		retryWriter: retryWriter,
+		parkWriter:  parkWriter,
+		retry:       policy,
+		workers:     workers,
+		batchSize:   batchSize,
+		pauses:      newPartitionPauses(),
+		breaker:     cfg.Breaker,
+		tiers:       retryTiers(cfg.Topic, cfg.RetryDelays),
+		tier:        tier,
+		groupID:     groupID,
+		host:        host,
+		version:     version,
 	}
 }
 
@@ -64,33 +182,84 @@ func (c *Consumer) CommitMessage(ctx context.Context, msg kafka.Message) error {
 }
 
 func (c *Consumer) Close() error {
+	if c.retryWriter != nil {
+		c.retryWriter.Close()
+	}
+	if c.parkWriter != nil {
+		c.parkWriter.Close()
+	}
+	if c.dlqWriter != nil {
+		c.dlqWriter.Close()
+	}
 	return c.reader.Close()
 }
 
-// sendToDLQ sends failed message to dead letter queue
-func (c *Consumer) sendToDLQ(ctx context.Context, msg kafka.Message, lastErr error) error {
-	if c.dlqWriter == nil {
-		log.Printf("DLQ not configured, dropping message: %s", string(msg.Key))
-		return nil
+// ConsumeLoop fetches messages and hands them to a pool of workers.
+// Messages are routed by key, so one author's events are still handled in
+// order while different authors are processed in parallel. Offsets are
+// committed only once every earlier message on the partition has finished.
+func (c *Consumer) ConsumeLoop(ctx context.Context, handler func(msg kafka.Message) error) {
+	tracker := newOffsetTracker()
+	completed := make(chan kafka.Message, c.workers*workerQueueSize)
+
+	// Each worker processes its queue in order (retry, panic protection, DLQ)
+	var wg sync.WaitGroup
+	queues := make([]chan kafka.Message, c.workers)
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, workerQueueSize)
+		wg.Add(1)
+		go func(queue <-chan kafka.Message) {
+			defer wg.Done()
+			for msg := range queue {
+				// Unfinished messages (shutdown mid-retry) are never marked
+				// complete, so their offsets stay uncommitted
+				if c.processMessage(ctx, handler, msg) {
+					completed <- msg
+				}
+			}
+		}(queues[i])
 	}
 
-	dlqMsg := kafka.Message{
-		Key:   msg.Key,
-		Value: msg.Value,
-		Headers: append(msg.Headers,
-			kafka.Header{Key: "original-topic", Value: []byte(msg.Topic)},
-			kafka.Header{Key: "error", Value: []byte(lastErr.Error())},
-			kafka.Header{Key: "failed-at", Value: []byte(time.Now().Format(time.RFC3339))},
-		),
+	// Single committer so offsets move forward in partition order.
+	// Commits outlive ctx so work finished during shutdown is not redone.
+	commitCtx := context.WithoutCancel(ctx)
+	committerDone := make(chan struct{})
+	go func() {
+		defer close(committerDone)
+		for msg := range completed {
+			if commit, ok := tracker.complete(msg); ok {
+				if err := c.CommitMessage(commitCtx, commit); err != nil {
+					log.Printf("Commit error: %v", err)
+				}
+			}
+		}
+	}()
+
+	c.fetchLoop(ctx, tracker, queues)
+
+	// Drain in-flight work before returning
+	for _, queue := range queues {
+		close(queue)
 	}
-	return c.dlqWriter.WriteMessages(ctx, dlqMsg)
+	wg.Wait()
+	close(completed)
+	<-committerDone
 }
 
-// consume loop processes messages with retry, backoff, panic recovery, and DLQ
-func (c *Consumer) ConsumeLoop(ctx context.Context, handler func(msg kafka.Message) error) {
+func (c *Consumer) fetchLoop(ctx context.Context, tracker *offsetTracker, queues []chan kafka.Message) {
 	fetchBackoff := time.Millisecond * 100
 	maxFetchBackoff := time.Second * 30
 
+	// One dispatcher per partition, so a paused partition only holds back its own messages
+	dispatchers := make(map[int]chan kafka.Message)
+	var dispatchWG sync.WaitGroup
+	defer func() {
+		for _, in := range dispatchers {
+			close(in)
+		}
+		dispatchWG.Wait()
+	}()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -99,6 +268,11 @@ func (c *Consumer) ConsumeLoop(ctx context.Context, handler func(msg kafka.Messa
 		default:
 		}
 
+		if !c.waitForBreaker(ctx) {
+			log.Println("Consumer shutting down...")
+			return
+		}
+
 		// Fetch with backoff on error
 		msg, err := c.FetchMessage(ctx)
 		if err != nil {
@@ -114,48 +288,250 @@ func (c *Consumer) ConsumeLoop(ctx context.Context, handler func(msg kafka.Messa
 		// Reset backoff on success
 		fetchBackoff = time.Millisecond * 100
 
-		// Process with retry * panic protection
-		var lastErr error
-		success := false
+		in, ok := dispatchers[msg.Partition]
+		if !ok {
+			in = make(chan kafka.Message, partitionBufferSize)
+			dispatchers[msg.Partition] = in
+			dispatchWG.Add(1)
+			go func() {
+				defer dispatchWG.Done()
+				c.dispatchPartition(ctx, in, tracker, queues)
+			}()
+		}
+		select {
+		case in <- msg:
+		case <-ctx.Done():
+			log.Println("Consumer shutting down...")
+			return
+		}
+	}
+}
 
-		for attempt := 1; attempt <= c.maxRetries; attempt++ {
-			lastErr = c.safeHandle(handler, msg)
-			if lastErr == nil {
-				success = true
-				break
+// dispatchPartition hands one partition's messages to the workers in fetch
+// order. It holds them while a throttled handler has the partition paused,
+// and on a retry tier until each message is due.
+func (c *Consumer) dispatchPartition(ctx context.Context, in <-chan kafka.Message, tracker *offsetTracker, queues []chan kafka.Message) {
+	for msg := range in {
+		if !c.pauses.wait(ctx, msg.Partition) || (c.tier >= 0 && !waitUntilDue(ctx, msg)) {
+			return
+		}
+
+		tracker.track(msg)
+		select {
+		case queues[c.workerFor(msg.Key)] <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ConsumeBatchLoop fetches up to batchSize messages at a time and hands them to
+// batchHandler, then commits the whole batch at once. If the batch fails, each
+// message is retried on its own through handler (with retry and DLQ), so one
+// bad event cannot block the rest of the batch.
+func (c *Consumer) ConsumeBatchLoop(ctx context.Context, batchHandler func(msgs []kafka.Message) error, handler func(msg kafka.Message) error) {
+	// Commits outlive ctx so a batch finished during shutdown is not redone
+	commitCtx := context.WithoutCancel(ctx)
+
+	for {
+		batch := c.fetchBatch(ctx)
+		if len(batch) == 0 {
+			if ctx.Err() != nil {
+				log.Println("Consumer shutting down...")
+				return
 			}
-			log.Printf("Handler error (attempt %d/%d): %v", attempt, c.maxRetries, lastErr)
-			if attempt < c.maxRetries {
-				// Exponential backoff between retries
-				backoff := time.Duration(attempt*attempt) * 100 * time.Millisecond
-				time.Sleep(backoff)
+			continue
+		}
+
+		if err := c.safeHandleBatch(batchHandler, batch); err != nil {
+			log.Printf("Batch of %d failed, falling back to per-message handling: %v", len(batch), err)
+			for _, msg := range batch {
+				if !c.processMessage(ctx, handler, msg) {
+					// Shutting down mid-batch: leave the batch uncommitted
+					return
+				}
 			}
 		}
-		if !success {
-			// Send to DLQ after max retries
-			log.Printf("Max retries exceeded, sending to DLQ: %s", string(msg.Key))
-			if err := c.sendToDLQ(ctx, msg, lastErr); err != nil {
+
+		if err := c.reader.CommitMessages(commitCtx, batch...); err != nil {
+			log.Printf("Commit error: %v", err)
+		}
+	}
+}
+
+// fetchBatch blocks for the first message, then collects more until the batch
+// is full or no message arrives within batchLinger
+func (c *Consumer) fetchBatch(ctx context.Context) []kafka.Message {
+	fetchBackoff := time.Millisecond * 100
+	maxFetchBackoff := time.Second * 30
+
+	if !c.waitForBreaker(ctx) {
+		return nil
+	}
+
+	var first kafka.Message
+	for {
+		msg, err := c.FetchMessage(ctx)
+		if err == nil {
+			first = msg
+			break
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Printf("Fetch error (backing off %v): %v", fetchBackoff, err)
+		time.Sleep(fetchBackoff)
+		fetchBackoff = min(fetchBackoff*2, maxFetchBackoff)
+	}
+
+	batch := []kafka.Message{first}
+	for len(batch) < c.batchSize {
+		lingerCtx, cancel := context.WithTimeout(ctx, batchLinger)
+		msg, err := c.FetchMessage(lingerCtx)
+		cancel()
+		if err != nil {
+			break
+		}
+		batch = append(batch, msg)
+	}
+	return batch
+}
+
+// waitForBreaker holds the fetcher while the breaker is open. Nothing new is
+// dispatched, so offsets stay uncommitted until the database recovers.
+// Returns false if ctx ends first.
+func (c *Consumer) waitForBreaker(ctx context.Context) bool {
+	if c.breaker == nil || c.breaker.State() != breaker.Open {
+		return true
+	}
+	log.Println("Circuit breaker open, pausing consumption")
+	if err := c.breaker.Wait(ctx); err != nil {
+		return false
+	}
+	log.Println("Circuit breaker let through, resuming consumption")
+	return true
+}
+
+// workerFor hashes a message key to a worker index
+func (c *Consumer) workerFor(key []byte) int {
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(c.workers))
+}
+
+// processMessage runs the handler with retry and panic protection.
+// Permanent errors go straight to the DLQ, unknown event types are parked,
+// throttled errors pause the partition without spending an attempt, and
+// failures while the database breaker is open wait for it to close. Other errors are retried under the
+// consumer's retry policy, then deferred to the next retry tier or the DLQ.
+// Returns false if ctx ended before the message was finished.
+func (c *Consumer) processMessage(ctx context.Context, handler func(msg kafka.Message) error, msg kafka.Message) bool {
+	var lastErr error
+	attempts := newAttemptLog(msg)
+	throttled := 0
+
+	for {
+		lastErr = retry.Do(ctx, c.retry, func() error {
+			err := c.safeHandle(handler, msg)
+			attempts.record(msg.Topic, err)
+			return err
+		})
+		if lastErr == nil {
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+
+		switch failure.KindOf(lastErr) {
+		case failure.Permanent:
+			log.Printf("Permanent failure, sending to DLQ: %s: %v", string(msg.Key), lastErr)
+			if err := c.sendToDLQ(ctx, msg, lastErr, failure.ReasonOf(lastErr), attempts); err != nil {
 				log.Printf("DLQ error: %v", err)
 			}
+			return true
+		case failure.Unhandled:
+			// Only committed once parked; false leaves the offset for a restart
+			return c.parkUntilDone(ctx, msg, lastErr, attempts)
+		case failure.Throttled:
+			if throttled >= maxThrottlePauses {
+				log.Printf("Still throttled after %d pauses, giving up on %s: %v", throttled, string(msg.Key), lastErr)
+				break
+			}
+			throttled++
+			pause := failure.RetryAfterOf(lastErr)
+			if pause <= 0 {
+				pause = defaultThrottlePause
+			}
+			log.Printf("Handler throttled, pausing partition %d for %v: %v", msg.Partition, pause, lastErr)
+			c.pauses.pause(msg.Partition, pause)
+			if !sleepCtx(ctx, pause) {
+				return false
+			}
+			continue
 		}
-		// Always commit after processing (success or DLQ)
-		// This prevents infinite retry loops
-		if err := c.CommitMessage(ctx, msg); err != nil {
-			log.Printf("Commit error: %v", err)
+		// The failures tripped the breaker: the database is down, not the
+		// message, so hold it until the breaker lets calls through again
+		if c.breaker != nil && c.breaker.State() == breaker.Open {
+			if !c.waitForBreaker(ctx) {
+				return false
+			}
+			continue
 		}
+		break
 	}
+
+	// Defer to the next retry tier so this partition keeps flowing
+	if next := c.tier + 1; next < len(c.tiers) {
+		err := c.forwardToRetry(ctx, msg, next, lastErr, attempts)
+		if err == nil {
+			log.Printf("Deferred message %s to %s", string(msg.Key), c.tiers[next].topic)
+			return true
+		}
+		log.Printf("Retry publish error, falling back to DLQ: %v", err)
+	}
+
+	// Send to DLQ after max retries
+	// The offset is still committed afterwards, which prevents infinite retry loops
+	log.Printf("Max retries exceeded, sending to DLQ: %s", string(msg.Key))
+	if err := c.sendToDLQ(ctx, msg, lastErr, failure.ReasonRetriesExhausted, attempts); err != nil {
+		log.Printf("DLQ error: %v", err)
+	}
+	return true
+}
+
+// panicError is a recovered handler panic and the stack it was raised on
+type panicError struct {
+	value any
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic recovered: %v", e.value)
 }
 
 // safeHandle wraps handler with panic recovery
 func (c *Consumer) safeHandle(handler func(msg kafka.Message) error, msg kafka.Message) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			err = fmt.Errorf("panic recovered: %v", r)
+			err = &panicError{value: r, stack: debug.Stack()}
 			log.Printf("Handler panic: %v", r)
 		}
 	}()
 	return handler(msg)
 }
+
+// safeHandleBatch wraps a batch handler with panic recovery
+func (c *Consumer) safeHandleBatch(handler func(msgs []kafka.Message) error, msgs []kafka.Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic recovered: %v", r)
+			log.Printf("Batch handler panic: %v", r)
+		}
+	}()
+	return handler(msgs)
+}
+
 func min(a, b time.Duration) time.Duration {
 	if a < b {
 		return a
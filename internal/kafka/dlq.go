@@ -0,0 +1,141 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers stamped on dead-lettered messages
+const (
+	HeaderError            = "error"
+	HeaderErrorReason      = "error-reason"     // failure.Reason* code
+	HeaderFailedAt         = "failed-at"        // RFC3339
+	HeaderSourcePartition  = "source-partition" // partition of the original topic it was consumed from
+	HeaderSourceOffset     = "source-offset"    // offset on that partition
+	HeaderConsumerGroup    = "consumer-group"   // group of the consumer that gave up on it
+	HeaderAttempts         = "attempts"         // handler runs across the whole retry chain
+	HeaderErrorHistory     = "error-history"    // JSON array of AttemptError, oldest first
+	HeaderProcessorHost    = "processor-host"
+	HeaderProcessorVersion = "processor-version"
+	HeaderStackTrace       = "stack-trace"  // stack of the last recovered panic, if any
+	HeaderReplayCount      = "replay-count" // times the message was replayed out of the DLQ
+)
+
+// maxErrorHistory bounds the error-history header; older attempts are dropped
+const maxErrorHistory = 20
+
+// AttemptError is one failed handler run in the error-history header
+type AttemptError struct {
+	Attempt int       `json:"attempt"`
+	At      time.Time `json:"at"`
+	Topic   string    `json:"topic"` // main topic or the retry tier it ran on
+	Error   string    `json:"error"`
+}
+
+// ErrorHistory decodes a message's error-history header
+func ErrorHistory(msg kafka.Message) ([]AttemptError, error) {
+	value := headerValue(msg, HeaderErrorHistory)
+	if value == "" {
+		return nil, nil
+	}
+	var history []AttemptError
+	err := json.Unmarshal([]byte(value), &history)
+	return history, err
+}
+
+// attemptLog tracks a message's handler runs. It starts from the headers left
+// by earlier retry tiers, so the counts cover the whole chain.
+type attemptLog struct {
+	count   int
+	history []AttemptError
+	stack   string
+}
+
+func newAttemptLog(msg kafka.Message) *attemptLog {
+	a := &attemptLog{stack: headerValue(msg, HeaderStackTrace)}
+	a.count, _ = strconv.Atoi(headerValue(msg, HeaderAttempts))
+	// A malformed history is dropped rather than failing the message
+	a.history, _ = ErrorHistory(msg)
+	return a
+}
+
+// record notes one handler run on topic
+func (a *attemptLog) record(topic string, err error) {
+	a.count++
+	if err == nil {
+		return
+	}
+	a.history = append(a.history, AttemptError{Attempt: a.count, At: time.Now(), Topic: topic, Error: err.Error()})
+	if len(a.history) > maxErrorHistory {
+		a.history = a.history[len(a.history)-maxErrorHistory:]
+	}
+	var p *panicError
+	if errors.As(err, &p) {
+		a.stack = string(p.stack)
+	}
+}
+
+// stamp sets the attempt headers, so the next tier or the DLQ carries them on
+func (a *attemptLog) stamp(headers []kafka.Header) []kafka.Header {
+	headers = setHeader(headers, HeaderAttempts, strconv.Itoa(a.count))
+	if history, err := json.Marshal(a.history); err == nil && len(a.history) > 0 {
+		headers = setHeader(headers, HeaderErrorHistory, string(history))
+	}
+	if a.stack != "" {
+		headers = setHeader(headers, HeaderStackTrace, a.stack)
+	}
+	return headers
+}
+
+// sendToDLQ sends failed message to dead letter queue, stamped with where it
+// came from, who gave up on it and every attempt's error. attempts may be nil.
+func (c *Consumer) sendToDLQ(ctx context.Context, msg kafka.Message, lastErr error, reason string, attempts *attemptLog) error {
+	if c.dlqWriter == nil {
+		log.Printf("DLQ not configured, dropping message: %s", string(msg.Key))
+		return nil
+	}
+
+	headers := withSource(msg)
+	if attempts != nil {
+		headers = attempts.stamp(headers)
+	}
+	headers = setHeader(headers, HeaderConsumerGroup, c.groupID)
+	headers = setHeader(headers, HeaderProcessorHost, c.host)
+	headers = setHeader(headers, HeaderProcessorVersion, c.version)
+	headers = setHeader(headers, HeaderError, lastErr.Error())
+	headers = setHeader(headers, HeaderErrorReason, reason)
+	headers = setHeader(headers, HeaderFailedAt, time.Now().Format(time.RFC3339))
+
+	return c.dlqWriter.WriteMessages(ctx, kafka.Message{
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	})
+}
+
+// withSource stamps the original topic, partition and offset the message was
+// consumed from, unless an earlier retry tier already did
+func withSource(msg kafka.Message) []kafka.Header {
+	headers := setHeader(msg.Headers, HeaderOriginalTopic, originalTopic(msg))
+	if headerValue(msg, HeaderSourceOffset) == "" {
+		headers = setHeader(headers, HeaderSourcePartition, strconv.Itoa(msg.Partition))
+		headers = setHeader(headers, HeaderSourceOffset, strconv.FormatInt(msg.Offset, 10))
+	}
+	return headers
+}
+
+// buildVersion is the module version Go stamped into the binary
+// ("(devel)" under go run)
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Version
+	}
+	return "unknown"
+}
@@ -0,0 +1,65 @@
+package kafka
+
+import (
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// offsetTracker decides which offsets are safe to commit when messages from
+// one partition finish out of order. An offset is only committable once every
+// earlier message fetched from that partition has finished.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+}
+
+type partitionOffsets struct {
+	pending []int64                 // fetched offsets in fetch order, not yet committed
+	done    map[int64]kafka.Message // finished messages waiting on an earlier offset
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[int]*partitionOffsets)}
+}
+
+// track records a fetched message. Must be called in fetch order, before the message is handed to a worker.
+func (t *offsetTracker) track(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[msg.Partition]
+	if !ok {
+		p = &partitionOffsets{done: make(map[int64]kafka.Message)}
+		t.partitions[msg.Partition] = p
+	}
+	p.pending = append(p.pending, msg.Offset)
+}
+
+// complete marks a message finished and returns the newest message whose
+// offset can now be committed, if any
+func (t *offsetTracker) complete(msg kafka.Message) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[msg.Partition]
+	if !ok {
+		return kafka.Message{}, false
+	}
+	p.done[msg.Offset] = msg
+
+	var (
+		commit kafka.Message
+		found  bool
+	)
+	for len(p.pending) > 0 {
+		m, finished := p.done[p.pending[0]]
+		if !finished {
+			break
+		}
+		delete(p.done, p.pending[0])
+		p.pending = p.pending[1:]
+		commit, found = m, true
+	}
+	return commit, found
+}
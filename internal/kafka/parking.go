@@ -0,0 +1,101 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/its-me-ojas/event-driven-feed/internal/failure"
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers stamped on parked messages
+const (
+	HeaderParkedAt     = "parked-at"     // RFC3339 time the message was parked
+	HeaderParkedReason = "parked-reason" // why the processor could not handle it
+)
+
+// park moves a message whose event type has no registered handler to the parking topic.
+// The original headers travel with it (minus retry bookkeeping) so Unpark can
+// re-inject it unchanged. Without a parking topic it goes to the DLQ instead.
+func (c *Consumer) park(ctx context.Context, msg kafka.Message, reason error, attempts *attemptLog) error {
+	if c.parkWriter == nil {
+		return c.sendToDLQ(ctx, msg, reason, failure.ReasonOf(reason), attempts)
+	}
+
+	headers := setHeader(withoutRetryHeaders(msg.Headers), HeaderOriginalTopic, originalTopic(msg))
+	parked := kafka.Message{
+		Key:   msg.Key,
+		Value: msg.Value,
+		Headers: append(headers,
+			kafka.Header{Key: HeaderParkedAt, Value: []byte(time.Now().Format(time.RFC3339))},
+			kafka.Header{Key: HeaderParkedReason, Value: []byte(reason.Error())},
+		),
+	}
+	if err := c.parkWriter.WriteMessages(ctx, parked); err != nil {
+		return err
+	}
+	log.Printf("Parked message %s from %s: %v", string(msg.Key), originalTopic(msg), reason)
+	return nil
+}
+
+// parkUntilDone parks msg, retrying with backoff while the parking topic is
+// unavailable, so the offset is never committed for an event that wasn't
+// parked. Returns false if ctx ends first.
+func (c *Consumer) parkUntilDone(ctx context.Context, msg kafka.Message, reason error, attempts *attemptLog) bool {
+	backoff := 100 * time.Millisecond
+	for {
+		err := c.park(ctx, msg, reason, attempts)
+		if err == nil {
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		log.Printf("Parking error (retrying in %v): %v", backoff, err)
+		if !sleepCtx(ctx, backoff) {
+			return false
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+// Unpark rebuilds a parked message for its original topic with the parking
+// headers removed, ready to be written back for a processor that knows its type
+func Unpark(msg kafka.Message) (kafka.Message, error) {
+	topic := headerValue(msg, HeaderOriginalTopic)
+	if topic == "" {
+		return kafka.Message{}, fmt.Errorf("parked message at offset %d has no %s header", msg.Offset, HeaderOriginalTopic)
+	}
+
+	var headers []kafka.Header
+	for _, h := range msg.Headers {
+		switch h.Key {
+		case HeaderOriginalTopic, HeaderParkedAt, HeaderParkedReason:
+			continue
+		}
+		headers = append(headers, h)
+	}
+	return kafka.Message{
+		Topic:   topic,
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	}, nil
+}
+
+// withoutRetryHeaders drops the retry chain's headers so a re-injected
+// message starts with a fresh set of attempts
+func withoutRetryHeaders(headers []kafka.Header) []kafka.Header {
+	out := make([]kafka.Header, 0, len(headers))
+	for _, h := range headers {
+		switch h.Key {
+		case HeaderRetryAttempt, HeaderRetryDueAt, HeaderRetryError,
+			HeaderSourcePartition, HeaderSourceOffset, HeaderAttempts, HeaderErrorHistory, HeaderStackTrace:
+			continue
+		}
+		out = append(out, h)
+	}
+	return out
+}
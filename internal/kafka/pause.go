@@ -0,0 +1,60 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultThrottlePause is used when a throttled error doesn't say how long to wait
+const defaultThrottlePause = time.Second
+
+// partitionPauses holds partitions back while a handler reports throttling.
+// A paused partition's dispatcher waits before handing over its next message;
+// other partitions keep flowing.
+type partitionPauses struct {
+	mu    sync.Mutex
+	until map[int]time.Time
+}
+
+func newPartitionPauses() *partitionPauses {
+	return &partitionPauses{until: make(map[int]time.Time)}
+}
+
+func (p *partitionPauses) pause(partition int, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	deadline := time.Now().Add(d)
+	if deadline.After(p.until[partition]) {
+		p.until[partition] = deadline
+	}
+}
+
+// wait blocks until the partition is no longer paused. Returns false if ctx ends first.
+func (p *partitionPauses) wait(ctx context.Context, partition int) bool {
+	for {
+		p.mu.Lock()
+		remaining := time.Until(p.until[partition])
+		p.mu.Unlock()
+
+		if remaining <= 0 {
+			return true
+		}
+		if !sleepCtx(ctx, remaining) {
+			return false
+		}
+	}
+}
+
+// sleepCtx sleeps for d. Returns false if ctx ends first.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
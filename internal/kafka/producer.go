@@ -4,33 +4,74 @@ import (
 	"context"
 	"time"
 
+	"github.com/its-me-ojas/event-driven-feed/internal/events"
 	"github.com/segmentio/kafka-go"
 )
 
 type Producer struct {
 	writer *kafka.Writer
+	topic  string // default topic; outbox entries may name another
+	codec  events.Codec
 }
 
-func NewProducer(brokers []string, topic string) *Producer {
+func NewProducer(brokers []string, topic string, codec events.Codec) *Producer {
 	w := &kafka.Writer{
 		Addr:         kafka.TCP(brokers...),
-		Topic:        topic,
 		Balancer:     &kafka.Hash{},
 		BatchSize:    100,
 		BatchTimeout: 10 * time.Millisecond,
 		RequiredAcks: kafka.RequireOne,
 	}
-	return &Producer{writer: w}
+	if codec == nil {
+		codec = events.JSONCodec
+	}
+	return &Producer{writer: w, topic: topic, codec: codec}
 }
 
-func (p *Producer) Publish(ctx context.Context, key string, value []byte) error {
+// Publish encodes the event with the producer's codec and stamps the
+// content-type header so consumers can pick the matching decoder
+func (p *Producer) Publish(ctx context.Context, key string, event *events.Event) error {
+	value, err := p.codec.Encode(event)
+	if err != nil {
+		return err
+	}
 	msg := kafka.Message{
+		Topic: p.topic,
 		Key:   []byte(key),
 		Value: value,
+		Headers: []kafka.Header{
+			{Key: events.ContentTypeHeader, Value: []byte(p.codec.ContentType())},
+		},
 	}
 	return p.writer.WriteMessages(ctx, msg)
 }
 
+// Encoded is an event that was encoded ahead of publishing, e.g. by the outbox
+type Encoded struct {
+	Topic       string // empty means the producer's topic
+	Key         string
+	Value       []byte
+	ContentType string
+}
+
+// PublishEncoded publishes pre-encoded events in order, in one write
+func (p *Producer) PublishEncoded(ctx context.Context, batch ...Encoded) error {
+	msgs := make([]kafka.Message, len(batch))
+	for i, e := range batch {
+		topic := e.Topic
+		if topic == "" {
+			topic = p.topic
+		}
+		msgs[i] = kafka.Message{
+			Topic:   topic,
+			Key:     []byte(e.Key),
+			Value:   e.Value,
+			Headers: []kafka.Header{{Key: events.ContentTypeHeader, Value: []byte(e.ContentType)}},
+		}
+	}
+	return p.writer.WriteMessages(ctx, msgs...)
+}
+
 func (p *Producer) Close() error {
 	return p.writer.Close()
 }
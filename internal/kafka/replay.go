@@ -0,0 +1,67 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ReplayMessage republishes a dead-lettered message without its failure
+// headers, to targetTopic if set and otherwise to the topic it originally
+// came from. The replay-count header is incremented, so a message that
+// keeps coming back to the DLQ after replays can be spotted.
+func ReplayMessage(ctx context.Context, w *kafka.Writer, m kafka.Message, targetTopic string) error {
+	var originalTopic string
+
+	// Find original topic from headers
+	// We filter out the error headers so we don't pollute the replayed message
+	var cleanHeaders []kafka.Header
+	for _, h := range m.Headers {
+		if h.Key == HeaderOriginalTopic {
+			originalTopic = string(h.Value)
+		} else if !IsFailureHeader(h.Key) {
+			cleanHeaders = append(cleanHeaders, h)
+		}
+	}
+
+	topic := originalTopic
+	if targetTopic != "" {
+		topic = targetTopic
+		// Keep where it came from, e.g. when replaying into a staging topic
+		if originalTopic != "" {
+			cleanHeaders = append(cleanHeaders, kafka.Header{Key: HeaderOriginalTopic, Value: []byte(originalTopic)})
+		}
+	}
+	if topic == "" {
+		return fmt.Errorf("could not find %s header", HeaderOriginalTopic)
+	}
+	cleanHeaders = setHeader(cleanHeaders, HeaderReplayCount, strconv.Itoa(ReplayCount(m)+1))
+
+	msg := kafka.Message{
+		Topic:   topic,
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: cleanHeaders,
+	}
+
+	return w.WriteMessages(ctx, msg)
+}
+
+// IsFailureHeader reports headers added by the consumer when a message failed
+func IsFailureHeader(key string) bool {
+	switch key {
+	case HeaderError, HeaderErrorReason, HeaderFailedAt, HeaderRetryAttempt, HeaderRetryDueAt, HeaderRetryError,
+		HeaderSourcePartition, HeaderSourceOffset, HeaderConsumerGroup, HeaderAttempts, HeaderErrorHistory,
+		HeaderProcessorHost, HeaderProcessorVersion, HeaderStackTrace:
+		return true
+	}
+	return false
+}
+
+// ReplayCount returns how many times a message has been replayed from the DLQ
+func ReplayCount(m kafka.Message) int {
+	n, _ := strconv.Atoi(headerValue(m, HeaderReplayCount))
+	return n
+}
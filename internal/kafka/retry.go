@@ -0,0 +1,114 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers stamped on messages travelling through the retry chain
+const (
+	HeaderOriginalTopic = "original-topic"
+	HeaderRetryAttempt  = "retry-attempt" // 1-based tier the message was sent to
+	HeaderRetryDueAt    = "retry-due-at"  // unix millis after which the tier may retry it
+	HeaderRetryError    = "retry-error"   // error from the attempt that deferred it
+)
+
+// retryTier is one delay topic in the retry chain
+type retryTier struct {
+	topic string
+	delay time.Duration
+}
+
+// RetryTopic names the delay topic for a tier, e.g. post-events.retry.30s
+func RetryTopic(base string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", base, shortDuration(delay))
+}
+
+func shortDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	default:
+		return fmt.Sprintf("%dms", d/time.Millisecond)
+	}
+}
+
+func retryTiers(base string, delays []time.Duration) []retryTier {
+	tiers := make([]retryTier, len(delays))
+	for i, d := range delays {
+		tiers[i] = retryTier{topic: RetryTopic(base, d), delay: d}
+	}
+	return tiers
+}
+
+// forwardToRetry publishes a failed message to the given tier with its due
+// time and the attempts made so far
+func (c *Consumer) forwardToRetry(ctx context.Context, msg kafka.Message, tier int, lastErr error, attempts *attemptLog) error {
+	t := c.tiers[tier]
+	due := time.Now().Add(t.delay)
+
+	headers := attempts.stamp(withSource(msg))
+	headers = setHeader(headers, HeaderRetryAttempt, strconv.Itoa(tier+1))
+	headers = setHeader(headers, HeaderRetryDueAt, strconv.FormatInt(due.UnixMilli(), 10))
+	headers = setHeader(headers, HeaderRetryError, lastErr.Error())
+
+	return c.retryWriter.WriteMessages(ctx, kafka.Message{
+		Topic:   t.topic,
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	})
+}
+
+// waitUntilDue holds a message from a retry tier until its due time.
+// Every message in a tier has the same delay, so waiting on the head of a
+// partition never holds back a message that is already due.
+// Returns false if ctx ends first.
+func waitUntilDue(ctx context.Context, msg kafka.Message) bool {
+	ms, err := strconv.ParseInt(headerValue(msg, HeaderRetryDueAt), 10, 64)
+	if err != nil {
+		return true
+	}
+	wait := time.Until(time.UnixMilli(ms))
+	if wait <= 0 {
+		return true
+	}
+	return sleepCtx(ctx, wait)
+}
+
+// originalTopic is the topic the message was first consumed from,
+// which differs from msg.Topic once it has moved through a retry tier
+func originalTopic(msg kafka.Message) string {
+	if topic := headerValue(msg, HeaderOriginalTopic); topic != "" {
+		return topic
+	}
+	return msg.Topic
+}
+
+func headerValue(msg kafka.Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// setHeader returns headers with key set to value, replacing any existing entries
+func setHeader(headers []kafka.Header, key, value string) []kafka.Header {
+	out := make([]kafka.Header, 0, len(headers)+1)
+	for _, h := range headers {
+		if h.Key != key {
+			out = append(out, h)
+		}
+	}
+	return append(out, kafka.Header{Key: key, Value: []byte(value)})
+}
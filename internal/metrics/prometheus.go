@@ -1,6 +1,9 @@
 package metrics
 
 import (
+	"time"
+
+	"github.com/its-me-ojas/event-driven-feed/internal/breaker"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -18,6 +21,27 @@ var (
 		Buckets: prometheus.DefBuckets,
 	}, []string{"type"})
 
+	RetryAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "feed_retry_attempts_total",
+		Help: "Retries scheduled by retry.Do, by component",
+	}, []string{"component"})
+
+	BreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "feed_circuit_breaker_state",
+		Help: "Circuit breaker state by dependency (0 closed, 1 half-open, 2 open)",
+	}, []string{"dependency"})
+
+	// Outbox relay metrics
+	OutboxLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "feed_outbox_lag_seconds",
+		Help: "Age of the oldest outbox entry not yet published to Kafka",
+	})
+
+	OutboxPublished = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "feed_outbox_published_total",
+		Help: "Outbox entries published to Kafka by the relay",
+	})
+
 	// API Metrics
 	HttpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "http_requests_total",
@@ -30,3 +54,19 @@ var (
 		Buckets: prometheus.DefBuckets,
 	}, []string{"method", "path"})
 )
+
+// ObserveRetry returns a retry.Policy OnRetry hook that counts retries for a component
+func ObserveRetry(component string) func(attempt int, err error, wait time.Duration) {
+	counter := RetryAttempts.WithLabelValues(component)
+	return func(int, error, time.Duration) {
+		counter.Inc()
+	}
+}
+
+// ObserveBreaker returns a breaker.Config OnStateChange hook that exports the state
+func ObserveBreaker(dependency string) func(state breaker.State) {
+	gauge := BreakerState.WithLabelValues(dependency)
+	return func(state breaker.State) {
+		gauge.Set(float64(state))
+	}
+}
@@ -0,0 +1,63 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/its-me-ojas/event-driven-feed/internal/events"
+	"github.com/its-me-ojas/event-driven-feed/internal/repository"
+	"github.com/jackc/pgx/v5"
+)
+
+// Outbox queues events in Postgres inside the caller's transaction, so an
+// event exists exactly when the writes it describes have committed.
+// The Relay publishes them to Kafka.
+type Outbox struct {
+	repo  *repository.OutboxRepo
+	codec events.Codec
+	topic string // empty means the relay's default topic
+}
+
+func New(repo *repository.OutboxRepo, codec events.Codec) *Outbox {
+	if codec == nil {
+		codec = events.JSONCodec
+	}
+	return &Outbox{repo: repo, codec: codec}
+}
+
+// Add encodes the event and stores it in tx. key is the Kafka partition key.
+func (o *Outbox) Add(ctx context.Context, tx pgx.Tx, key string, event *events.Event) error {
+	payload, err := o.codec.Encode(event)
+	if err != nil {
+		return fmt.Errorf("encode event %d: %w", event.EventID, err)
+	}
+	return o.repo.Add(ctx, tx, &repository.OutboxEntry{
+		EventID:      event.EventID,
+		Topic:        o.topic,
+		PartitionKey: key,
+		ContentType:  o.codec.ContentType(),
+		Payload:      payload,
+	})
+}
+
+// ForTopic returns an Outbox whose entries the relay publishes to topic
+func (o *Outbox) ForTopic(topic string) *Outbox {
+	c := *o
+	c.topic = topic
+	return &c
+}
+
+// AddFeedUpdated stores a feed update in tx, keyed by author so a post's
+// chunks stay in order. Feed updates are always JSON.
+func (o *Outbox) AddFeedUpdated(ctx context.Context, tx pgx.Tx, event *events.FeedUpdatedEvent) error {
+	payload, err := event.Marshal()
+	if err != nil {
+		return fmt.Errorf("encode feed update for post %d chunk %d: %w", event.PostID, event.Chunk, err)
+	}
+	return o.repo.Add(ctx, tx, &repository.OutboxEntry{
+		Topic:        o.topic,
+		PartitionKey: event.AuthorID,
+		ContentType:  events.ContentTypeJSON,
+		Payload:      payload,
+	})
+}
@@ -0,0 +1,136 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/its-me-ojas/event-driven-feed/internal/kafka"
+	"github.com/its-me-ojas/event-driven-feed/internal/metrics"
+	"github.com/its-me-ojas/event-driven-feed/internal/repository"
+	"github.com/jackc/pgx/v5"
+)
+
+// Publisher sends encoded events to Kafka in order
+type Publisher interface {
+	PublishEncoded(ctx context.Context, batch ...kafka.Encoded) error
+}
+
+type RelayConfig struct {
+	PollInterval time.Duration // how often an idle relay checks for new entries
+	BatchSize    int           // entries published per transaction
+	Retention    time.Duration // how long sent entries are kept
+}
+
+// Relay publishes outbox entries in id order and marks them sent. Entries are
+// published before the transaction marking them commits, so a crash in
+// between re-sends them; the processor's idempotency absorbs the duplicates.
+type Relay struct {
+	db        *repository.DB
+	repo      *repository.OutboxRepo
+	publisher Publisher
+	cfg       RelayConfig
+}
+
+func NewRelay(db *repository.DB, repo *repository.OutboxRepo, publisher Publisher, cfg RelayConfig) *Relay {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 100 * time.Millisecond
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 24 * time.Hour
+	}
+	return &Relay{db: db, repo: repo, publisher: publisher, cfg: cfg}
+}
+
+// Run relays until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+	lastPrune := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Drain full batches back to back, then wait for the next tick
+		for {
+			sent, err := r.relayBatch(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Outbox relay error: %v", err)
+				}
+				break
+			}
+			if sent < r.cfg.BatchSize {
+				break
+			}
+		}
+		r.recordLag(ctx)
+
+		if time.Since(lastPrune) > time.Minute {
+			lastPrune = time.Now()
+			if _, err := r.repo.PruneSent(ctx, r.cfg.Retention); err != nil {
+				log.Printf("Outbox prune error: %v", err)
+			}
+		}
+	}
+}
+
+// relayBatch publishes one batch of unsent entries. Returns how many were sent.
+func (r *Relay) relayBatch(ctx context.Context) (int, error) {
+	var sent int
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		// Another relay (e.g. a second API instance) is already publishing
+		locked, err := r.repo.LockRelay(ctx, tx)
+		if err != nil || !locked {
+			return err
+		}
+
+		entries, err := r.repo.FetchUnsent(ctx, tx, r.cfg.BatchSize)
+		if err != nil {
+			return fmt.Errorf("fetch unsent: %w", err)
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		batch := make([]kafka.Encoded, len(entries))
+		ids := make([]int64, len(entries))
+		for i, e := range entries {
+			batch[i] = kafka.Encoded{Topic: e.Topic, Key: e.PartitionKey, Value: e.Payload, ContentType: e.ContentType}
+			ids[i] = e.ID
+		}
+		if err := r.publisher.PublishEncoded(ctx, batch...); err != nil {
+			return fmt.Errorf("publish: %w", err)
+		}
+		if err := r.repo.MarkSent(ctx, tx, ids); err != nil {
+			return fmt.Errorf("mark sent: %w", err)
+		}
+		sent = len(entries)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	metrics.OutboxPublished.Add(float64(sent))
+	return sent, nil
+}
+
+// recordLag exports the age of the oldest unsent entry (0 when drained)
+func (r *Relay) recordLag(ctx context.Context) {
+	lag, err := r.repo.Lag(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Outbox lag check error: %v", err)
+		}
+		return
+	}
+	metrics.OutboxLag.Set(lag.Seconds())
+}
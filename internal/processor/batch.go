@@ -0,0 +1,66 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/its-me-ojas/event-driven-feed/internal/events"
+	"github.com/jackc/pgx/v5"
+	"github.com/segmentio/kafka-go"
+)
+
+// HandleBatch processes several messages at once in a single transaction.
+// Every event in the batch is claimed in processed_events with one statement,
+// and the newly claimed ones are dispatched in offset order; events already
+// processed are skipped.
+//
+// Any error rolls the batch back; the consumer then falls back to Handle per
+// message so one bad event cannot block the others.
+func (h *EventHandler) HandleBatch(msgs []kafka.Message) error {
+	ctx := context.Background()
+
+	// 1. Decode everything up front; a bad message or an unknown event type
+	// sends the batch down the per-message path
+	decoded := make([]*events.Event, len(msgs))
+	eventIDs := make([]int64, len(msgs))
+	for i, msg := range msgs {
+		event, err := decode(msg)
+		if err != nil {
+			return fmt.Errorf("unmarshal error at offset %d: %v", msg.Offset, err)
+		}
+		if !h.registry.Handles(event.Type) {
+			return fmt.Errorf("unknown event type %q at offset %d", event.Type, msg.Offset)
+		}
+		decoded[i] = event
+		eventIDs[i] = event.EventID
+	}
+
+	// 2. Claim the batch and apply the new events in one transaction. The
+	// registry's idempotency middleware sees the claims and doesn't repeat them.
+	var fx Effects
+	err := h.db.WithTx(ctx, func(tx pgx.Tx) error {
+		claimed, err := h.idempotencyRepo.MarkProcessedBatch(ctx, tx, eventIDs)
+		if err != nil {
+			return fmt.Errorf("idempotency check failed: %w", err)
+		}
+		fx.claimed = claimed
+		dispatched := make(map[int64]bool, len(claimed))
+		for _, event := range decoded {
+			// Already processed, or a duplicate earlier in this batch
+			if !claimed[event.EventID] || dispatched[event.EventID] {
+				continue
+			}
+			dispatched[event.EventID] = true
+			if err := h.registry.dispatch(ctx, tx, event, &fx); err != nil {
+				return fmt.Errorf("event %d: %v", event.EventID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("batch transaction failed: %v", err)
+	}
+
+	fx.apply(ctx)
+	return nil
+}
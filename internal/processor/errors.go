@@ -0,0 +1,50 @@
+package processor
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/its-me-ojas/event-driven-feed/internal/breaker"
+	"github.com/its-me-ojas/event-driven-feed/internal/events"
+	"github.com/its-me-ojas/event-driven-feed/internal/failure"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// throttlePause is how long the consumer pauses a partition when Postgres is overloaded
+const throttlePause = 2 * time.Second
+
+// classifyDecode marks decode failures permanent: retrying the same bytes can never succeed
+func classifyDecode(err error) error {
+	var versionErr *events.UnsupportedVersionError
+	if errors.As(err, &versionErr) {
+		return failure.NewPermanent(failure.ReasonUnsupportedSchema, err)
+	}
+	return failure.NewPermanent(failure.ReasonDecode, err)
+}
+
+// classify maps Postgres errors onto the consumer's failure kinds.
+// Anything it doesn't recognise stays retryable.
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	// Postgres is down: hold the partition until the breaker lets calls through
+	if errors.Is(err, breaker.ErrOpen) {
+		return failure.NewThrottled(throttlePause, err)
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch {
+	// Class 53: insufficient resources (too many connections, out of memory, disk full)
+	// 57P03: cannot connect now (server starting up)
+	case strings.HasPrefix(pgErr.Code, "53"), pgErr.Code == "57P03":
+		return failure.NewThrottled(throttlePause, err)
+	// Class 22: data exception (e.g. content too long), class 23: integrity violation
+	case strings.HasPrefix(pgErr.Code, "22"), strings.HasPrefix(pgErr.Code, "23"):
+		return failure.NewPermanent(failure.ReasonInvalidData, err)
+	}
+	return err
+}
@@ -0,0 +1,391 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/its-me-ojas/event-driven-feed/internal/events"
+	"github.com/its-me-ojas/event-driven-feed/internal/repository"
+	"github.com/jackc/pgx/v5"
+)
+
+// HandlerConfig holds the processor's tuning knobs
+type HandlerConfig struct {
+	BackfillLimit      int // recent posts copied into a new follower's feed
+	CelebrityThreshold int // follower count at which fan-out on write is skipped
+	FanoutChunkSize    int // followers written per fan-out chunk
+	FeedCacheMaxLen    int // posts kept in a cached feed when new ones are pushed in
+}
+
+// FeedPublisher queues FEED_UPDATED events for the feed-events topic inside
+// the fan-out's transaction (see outbox.Outbox)
+type FeedPublisher interface {
+	AddFeedUpdated(ctx context.Context, tx pgx.Tx, event *events.FeedUpdatedEvent) error
+}
+
+// FeedHandlers handles the post and follow events that build users' feeds
+type FeedHandlers struct {
+	db            *repository.DB // fan-out chunks after the first commit on their own
+	feedRepo      *repository.FeedRepo
+	followersRepo *repository.FollowersRepo
+	postsRepo     *repository.PostsRepo
+	feedCache     *repository.FeedCache
+	publisher     FeedPublisher // nil disables feed-events
+	cfg           HandlerConfig
+}
+
+func NewFeedHandlers(db *repository.DB, feed *repository.FeedRepo, followers *repository.FollowersRepo, posts *repository.PostsRepo, feedCache *repository.FeedCache, publisher FeedPublisher, cfg HandlerConfig) *FeedHandlers {
+	if cfg.FanoutChunkSize <= 0 {
+		cfg.FanoutChunkSize = 500
+	}
+	if cfg.FeedCacheMaxLen <= 0 {
+		cfg.FeedCacheMaxLen = 100
+	}
+	return &FeedHandlers{
+		db:            db,
+		feedRepo:      feed,
+		followersRepo: followers,
+		postsRepo:     posts,
+		feedCache:     feedCache,
+		publisher:     publisher,
+		cfg:           cfg,
+	}
+}
+
+// Register adds the feed handlers to r
+func (f *FeedHandlers) Register(r *Registry) {
+	r.Register(events.EventTypePostCreated, HandlerFunc(f.handlePostCreated))
+	r.Register(events.EventTypePostDeleted, HandlerFunc(f.handlePostDeleted))
+	r.Register(events.EventTypePostUpdated, HandlerFunc(f.handlePostUpdated))
+	r.Register(events.EventTypeFollowCreated, HandlerFunc(f.handleFollowCreated))
+	r.Register(events.EventTypeFollowDeleted, HandlerFunc(f.handleFollowDeleted))
+}
+
+// invalidate evicts cached feeds after the commit. Postgres is the source of
+// truth, so a cache failure only gets logged.
+func (f *FeedHandlers) invalidate(fx *Effects, userIDs ...string) {
+	fx.AfterCommit(func(ctx context.Context) {
+		for _, userID := range userIDs {
+			if err := f.feedCache.InvalidateFeed(ctx, userID); err != nil {
+				log.Printf("failed to invalidate feed cache for %s: %v", userID, err)
+			}
+		}
+	})
+}
+
+// pushToCache writes a fanned-out post through to the recipients' cached
+// feeds after the commit, so they don't wait for the TTL to see it. Like
+// invalidate, a Redis failure is only logged and never fails the event.
+func (f *FeedHandlers) pushToCache(fx *Effects, userIDs []string, postID int64) {
+	fx.AfterCommit(func(ctx context.Context) {
+		if err := f.feedCache.PushToFeeds(ctx, userIDs, postID, f.cfg.FeedCacheMaxLen); err != nil {
+			log.Printf("failed to push post %d to %d cached feeds: %v", postID, len(userIDs), err)
+		}
+	})
+}
+
+// publish queues a feed update in tx, so it is sent exactly when the chunk
+// it describes commits. The outbox relay publishes it in batches.
+func (f *FeedHandlers) publish(ctx context.Context, tx pgx.Tx, update *events.FeedUpdatedEvent) error {
+	if f.publisher == nil {
+		return nil
+	}
+	if err := f.publisher.AddFeedUpdated(ctx, tx, update); err != nil {
+		return fmt.Errorf("failed to queue feed update: %w", err)
+	}
+	return nil
+}
+
+func (f *FeedHandlers) handlePostCreated(ctx context.Context, tx pgx.Tx, event *events.Event, fx *Effects) error {
+	authorID := event.ActorID
+	postID := event.Payload.PostID
+	content := event.Payload.Content
+
+	// Retry tiers let a later event for the same author overtake this one;
+	// a POST_DELETED that already ran must not be undone
+	deleted, err := f.postsRepo.IsDeleted(ctx, tx, postID)
+	if err != nil {
+		return fmt.Errorf("failed to check for deleted post: %w", err)
+	}
+	if deleted {
+		log.Printf("Skipping POST_CREATED %d: post %d was already deleted", event.EventID, postID)
+		return nil
+	}
+
+	post := &repository.Post{
+		PostID:    postID,
+		AuthorID:  authorID,
+		Content:   content,
+		CreatedAt: time.Unix(event.Timestamp, 0),
+	}
+	if err := f.postsRepo.Create(ctx, tx, post); err != nil {
+		return fmt.Errorf("Failed to persist post: %w", err)
+	}
+
+	// for follower count
+	count, err := f.followersRepo.GetFollowerCount(ctx, tx, authorID)
+	if err != nil {
+		return fmt.Errorf("failed to get follower count: %w", err)
+	}
+
+	// Celebrity posts are merged into followers' feeds at read time
+	if count >= f.cfg.CelebrityThreshold {
+		log.Printf("User %s is a celebrity (%d followers skipping fan out)", authorID, count)
+		update := events.NewFeedUpdatedEvent(event.EventID, postID, authorID, nil, 0, true)
+		update.FanoutOnRead = true
+		return f.publish(ctx, tx, update)
+	}
+
+	// Fan out in fixed-size chunks, walking followers with a keyset cursor,
+	// each chunk reported as one FEED_UPDATED event. The first chunk commits
+	// in tx with the post and its processed_events claim. If there are more,
+	// a checkpoint commits with it and the rest are written after the commit,
+	// one transaction each (see continueFanout), so no transaction holds
+	// every follower's row and a crash resumes from the checkpoint.
+	followers, err := f.followersRepo.GetFollowersPage(ctx, tx, authorID, "", f.cfg.FanoutChunkSize)
+	if err != nil {
+		return fmt.Errorf("failed to fetch followers: %w", err)
+	}
+	// A short chunk is the last one (an empty one closes the sequence for
+	// authors without followers)
+	final := len(followers) < f.cfg.FanoutChunkSize
+	if err := f.addChunk(ctx, tx, events.NewFeedUpdatedEvent(event.EventID, postID, authorID, followers, 0, final)); err != nil {
+		return fmt.Errorf("feed fan-out failed: %w", err)
+	}
+	f.pushToCache(fx, followers, postID)
+	if final {
+		return nil
+	}
+
+	cp := &repository.FanoutCheckpoint{
+		EventID:        event.EventID,
+		PostID:         postID,
+		AuthorID:       authorID,
+		LastFollowerID: followers[len(followers)-1],
+		NextChunk:      1,
+	}
+	if err := f.feedRepo.SaveFanoutCheckpoint(ctx, tx, cp); err != nil {
+		return fmt.Errorf("failed to save fan-out checkpoint: %w", err)
+	}
+	fx.AfterCommit(func(ctx context.Context) {
+		f.continueFanout(ctx, event.EventID)
+	})
+	return nil
+}
+
+// addChunk writes a fan-out chunk and queues its FEED_UPDATED event in tx
+func (f *FeedHandlers) addChunk(ctx context.Context, tx pgx.Tx, update *events.FeedUpdatedEvent) error {
+	if err := f.feedRepo.AddToFeedChunk(ctx, tx, update.RecipientIDs, update.PostID); err != nil {
+		return err
+	}
+	return f.publish(ctx, tx, update)
+}
+
+// continueFanout writes the remaining chunks of a checkpointed fan-out. A
+// failure is only logged: the checkpoint keeps the progress and
+// ResumeFanouts picks the fan-out up again.
+func (f *FeedHandlers) continueFanout(ctx context.Context, eventID int64) {
+	for {
+		done, err := f.fanoutChunk(ctx, eventID)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("fan-out of event %d stopped, it will be resumed: %v", eventID, err)
+			}
+			return
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// fanoutChunk writes the next chunk of a fan-out in its own transaction and
+// moves the checkpoint past it, or clears it after the last chunk. It reports
+// done when nothing is left for this caller: the fan-out finished, was
+// cancelled by a POST_DELETED, or another worker holds the checkpoint.
+func (f *FeedHandlers) fanoutChunk(ctx context.Context, eventID int64) (bool, error) {
+	var (
+		done      bool
+		postID    int64
+		followers []string
+	)
+	err := f.db.WithTx(ctx, func(tx pgx.Tx) error {
+		done, followers = false, nil
+		cp, err := f.feedRepo.LockFanoutCheckpoint(ctx, tx, eventID)
+		if err != nil {
+			return fmt.Errorf("failed to read fan-out checkpoint: %w", err)
+		}
+		if cp == nil {
+			done = true
+			return nil
+		}
+		postID = cp.PostID
+
+		followers, err = f.followersRepo.GetFollowersPage(ctx, tx, cp.AuthorID, cp.LastFollowerID, f.cfg.FanoutChunkSize)
+		if err != nil {
+			return fmt.Errorf("failed to fetch followers: %w", err)
+		}
+		final := len(followers) < f.cfg.FanoutChunkSize
+		if err := f.addChunk(ctx, tx, events.NewFeedUpdatedEvent(eventID, cp.PostID, cp.AuthorID, followers, cp.NextChunk, final)); err != nil {
+			return fmt.Errorf("feed fan-out failed: %w", err)
+		}
+		if final {
+			done = true
+			return f.feedRepo.ClearFanoutCheckpoint(ctx, tx, eventID)
+		}
+		cp.LastFollowerID = followers[len(followers)-1]
+		cp.NextChunk++
+		return f.feedRepo.SaveFanoutCheckpoint(ctx, tx, cp)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// Like pushToCache, a Redis failure is only logged
+	if err := f.feedCache.PushToFeeds(ctx, followers, postID, f.cfg.FeedCacheMaxLen); err != nil {
+		log.Printf("failed to push post %d to %d cached feeds: %v", postID, len(followers), err)
+	}
+	return done, nil
+}
+
+// ResumeFanouts finishes fan-outs whose worker stopped part way (a crash, or
+// a chunk that failed), checking every interval until ctx is cancelled
+func (f *FeedHandlers) ResumeFanouts(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		eventIDs, err := f.feedRepo.StaleFanouts(ctx, interval, 100)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("failed to list stalled fan-outs: %v", err)
+			}
+			continue
+		}
+		for _, eventID := range eventIDs {
+			log.Printf("Resuming fan-out of event %d", eventID)
+			f.continueFanout(ctx, eventID)
+		}
+	}
+}
+
+func (f *FeedHandlers) handlePostDeleted(ctx context.Context, tx pgx.Tx, event *events.Event, fx *Effects) error {
+	postID := event.Payload.PostID
+
+	// 1. Stop a fan-out still in progress first. This waits for a chunk being
+	// written, so its rows are removed below too.
+	if err := f.feedRepo.CancelFanouts(ctx, tx, postID); err != nil {
+		return fmt.Errorf("failed to cancel fan-out: %w", err)
+	}
+
+	// 2. Pull the post out of every feed it was fanned out to
+	userIDs, err := f.feedRepo.RemoveFromFeeds(ctx, tx, postID)
+	if err != nil {
+		return fmt.Errorf("failed to remove post from feeds: %w", err)
+	}
+
+	// 3. Delete the post itself
+	if err := f.postsRepo.Delete(ctx, tx, postID); err != nil {
+		return fmt.Errorf("failed to delete post: %w", err)
+	}
+
+	// 4. Evict cached feeds so readers don't keep seeing the post until TTL
+	f.invalidate(fx, userIDs...)
+	return nil
+}
+
+func (f *FeedHandlers) handlePostUpdated(ctx context.Context, tx pgx.Tx, event *events.Event, _ *Effects) error {
+	postID := event.Payload.PostID
+
+	// An edit that overtook its POST_CREATED fails with ErrPostNotFound and
+	// rolls back, so the consumer's retry (or a DLQ replay) can apply it later
+	applied, err := f.postsRepo.Update(ctx, tx, postID, event.Payload.Content, event.EventID, time.Unix(event.Timestamp, 0))
+	if errors.Is(err, repository.ErrPostNotFound) {
+		// Not an edit that overtook its create but one that arrived after the delete
+		deleted, checkErr := f.postsRepo.IsDeleted(ctx, tx, postID)
+		if checkErr != nil {
+			return fmt.Errorf("failed to check for deleted post: %w", checkErr)
+		}
+		if deleted {
+			log.Printf("Skipping edit %d for deleted post %d", event.EventID, postID)
+			return nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update post %d: %w", postID, err)
+	}
+	if !applied {
+		log.Printf("Skipping stale edit %d for post %d", event.EventID, postID)
+	}
+	return nil
+}
+
+// claimFollowVersion reports whether a follow or unfollow is the newest event
+// for its edge. Retry tiers let a later event for the same edge overtake this
+// one; applying the older one afterwards would undo it.
+func (f *FeedHandlers) claimFollowVersion(ctx context.Context, tx pgx.Tx, event *events.Event) (bool, error) {
+	current, err := f.followersRepo.ClaimFollowVersion(ctx, tx, event.ActorID, event.Payload.FolloweeID, event.EventID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check follow version: %w", err)
+	}
+	if !current {
+		log.Printf("Skipping %s %d: a newer follow event for %s -> %s was already applied",
+			event.Type, event.EventID, event.ActorID, event.Payload.FolloweeID)
+	}
+	return current, nil
+}
+
+func (f *FeedHandlers) handleFollowCreated(ctx context.Context, tx pgx.Tx, event *events.Event, fx *Effects) error {
+	followerID := event.ActorID
+	followeeID := event.Payload.FolloweeID
+
+	if current, err := f.claimFollowVersion(ctx, tx, event); err != nil || !current {
+		return err
+	}
+	if err := f.followersRepo.Follow(ctx, tx, followerID, followeeID); err != nil {
+		return fmt.Errorf("failed to follow: %w", err)
+	}
+
+	// Backfill so the new follower doesn't see an empty feed until the followee posts again
+	if f.cfg.BackfillLimit > 0 {
+		posts, err := f.postsRepo.GetRecentByAuthor(ctx, tx, followeeID, f.cfg.BackfillLimit)
+		if err != nil {
+			return fmt.Errorf("failed to fetch posts for backfill: %w", err)
+		}
+		if err := f.feedRepo.BackfillFeed(ctx, tx, followerID, posts); err != nil {
+			return fmt.Errorf("feed backfill failed: %w", err)
+		}
+	}
+
+	f.invalidate(fx, followerID)
+	return nil
+}
+
+func (f *FeedHandlers) handleFollowDeleted(ctx context.Context, tx pgx.Tx, event *events.Event, fx *Effects) error {
+	followerID := event.ActorID
+	followeeID := event.Payload.FolloweeID
+
+	if current, err := f.claimFollowVersion(ctx, tx, event); err != nil || !current {
+		return err
+	}
+	if err := f.followersRepo.Unfollow(ctx, tx, followerID, followeeID); err != nil {
+		return fmt.Errorf("failed to unfollow: %w", err)
+	}
+	if err := f.feedRepo.RemoveAuthorFromFeed(ctx, tx, followerID, followeeID); err != nil {
+		return fmt.Errorf("feed pruning failed: %w", err)
+	}
+
+	f.invalidate(fx, followerID)
+	return nil
+}
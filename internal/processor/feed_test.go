@@ -0,0 +1,189 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/its-me-ojas/event-driven-feed/internal/breaker"
+	"github.com/its-me-ojas/event-driven-feed/internal/cache"
+	"github.com/its-me-ojas/event-driven-feed/internal/events"
+	"github.com/its-me-ojas/event-driven-feed/internal/repository"
+	"github.com/its-me-ojas/event-driven-feed/internal/retry"
+	"github.com/redis/go-redis/v9"
+	"github.com/segmentio/kafka-go"
+)
+
+// testDB connects to TEST_DATABASE_URL (a migrated database, e.g. the
+// docker-compose one) or skips the test
+func testDB(t *testing.T) *repository.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := repository.NewDB(context.Background(), url, retry.DefaultPolicy, breaker.DefaultConfig)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+func message(t *testing.T, event *events.Event) kafka.Message {
+	t.Helper()
+	value, err := events.JSONCodec.Encode(event)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return kafka.Message{Key: []byte(event.ActorID), Value: value}
+}
+
+// A POST_CREATED deferred to a retry tier runs after the POST_DELETED for the
+// same post; it must not bring the post back or fan it out
+func TestPostCreatedRetriedAfterDelete(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	base := time.Now().UnixNano()
+	postID := base
+	author := fmt.Sprintf("author-%d", base)
+	follower := fmt.Sprintf("follower-%d", base)
+
+	// Fan-out never reaches the cache here; the client is never dialled
+	feedCache := repository.NewFeedCache(&cache.RedisClient{Client: redis.NewClient(&redis.Options{})}, retry.DefaultPolicy)
+	postsRepo := repository.NewPostsRepo(db)
+	registry := NewRegistry(Idempotency(repository.NewIdempotencyRepo(db)))
+	NewFeedHandlers(db, repository.NewFeedRepo(db), repository.NewFollowersRepo(db), postsRepo, feedCache, nil,
+		HandlerConfig{CelebrityThreshold: 1000}).Register(registry)
+	handler := NewEventHandler(db, repository.NewIdempotencyRepo(db), registry)
+
+	if _, err := db.Pool.Exec(ctx, `INSERT INTO followers (follower_id, followee_id) VALUES ($1, $2)`, follower, author); err != nil {
+		t.Fatalf("seed follower: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Pool.Exec(ctx, `DELETE FROM followers WHERE followee_id = $1`, author)
+		db.Pool.Exec(ctx, `DELETE FROM feeds WHERE post_id = $1`, postID)
+		db.Pool.Exec(ctx, `DELETE FROM posts WHERE post_id = $1`, postID)
+		db.Pool.Exec(ctx, `DELETE FROM deleted_posts WHERE post_id = $1`, postID)
+		db.Pool.Exec(ctx, `DELETE FROM processed_events WHERE event_id IN ($1, $2)`, base+1, base+2)
+	})
+
+	// The API stored the post; its POST_CREATED failed and went to a retry tier
+	created := events.NewPostCreatedEvent(base+1, postID, author, "hello")
+	if _, err := db.Pool.Exec(ctx, `INSERT INTO posts (post_id, author_id, content) VALUES ($1, $2, $3)`, postID, author, "hello"); err != nil {
+		t.Fatalf("seed post: %v", err)
+	}
+
+	// Meanwhile the delete goes through on the main topic
+	if err := handler.Handle(message(t, events.NewPostDeletedEvent(base+2, postID, author))); err != nil {
+		t.Fatalf("POST_DELETED: %v", err)
+	}
+	// Then the create is retried
+	if err := handler.Handle(message(t, created)); err != nil {
+		t.Fatalf("retried POST_CREATED: %v", err)
+	}
+
+	var posts, feeds int
+	db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM posts WHERE post_id = $1`, postID).Scan(&posts)
+	db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM feeds WHERE post_id = $1`, postID).Scan(&feeds)
+	if posts != 0 || feeds != 0 {
+		t.Errorf("deleted post came back: %d posts, %d feed rows", posts, feeds)
+	}
+}
+
+// A fan-out larger than one chunk commits its first chunk with the post and
+// finishes the rest after the commit, leaving no checkpoint behind
+func TestFanoutOverSeveralChunks(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	base := time.Now().UnixNano()
+	postID := base
+	author := fmt.Sprintf("author-%d", base)
+
+	// Cache pushes fail without Redis and are only logged
+	feedCache := repository.NewFeedCache(&cache.RedisClient{Client: redis.NewClient(&redis.Options{})}, retry.DefaultPolicy)
+	registry := NewRegistry(Idempotency(repository.NewIdempotencyRepo(db)))
+	NewFeedHandlers(db, repository.NewFeedRepo(db), repository.NewFollowersRepo(db), repository.NewPostsRepo(db), feedCache, nil,
+		HandlerConfig{CelebrityThreshold: 1000, FanoutChunkSize: 2}).Register(registry)
+	handler := NewEventHandler(db, repository.NewIdempotencyRepo(db), registry)
+
+	const followers = 5
+	for i := range followers {
+		if _, err := db.Pool.Exec(ctx, `INSERT INTO followers (follower_id, followee_id) VALUES ($1, $2)`,
+			fmt.Sprintf("follower-%d-%d", base, i), author); err != nil {
+			t.Fatalf("seed follower: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		db.Pool.Exec(ctx, `DELETE FROM followers WHERE followee_id = $1`, author)
+		db.Pool.Exec(ctx, `DELETE FROM feeds WHERE post_id = $1`, postID)
+		db.Pool.Exec(ctx, `DELETE FROM posts WHERE post_id = $1`, postID)
+		db.Pool.Exec(ctx, `DELETE FROM fanout_checkpoints WHERE event_id = $1`, base+1)
+		db.Pool.Exec(ctx, `DELETE FROM processed_events WHERE event_id = $1`, base+1)
+	})
+
+	if err := handler.Handle(message(t, events.NewPostCreatedEvent(base+1, postID, author, "hello"))); err != nil {
+		t.Fatalf("POST_CREATED: %v", err)
+	}
+
+	var feeds, checkpoints int
+	db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM feeds WHERE post_id = $1`, postID).Scan(&feeds)
+	db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM fanout_checkpoints WHERE event_id = $1`, base+1).Scan(&checkpoints)
+	if feeds != followers || checkpoints != 0 {
+		t.Errorf("got %d feed rows and %d checkpoints, want %d and 0", feeds, checkpoints, followers)
+	}
+}
+
+// A follow or unfollow deferred to a retry tier runs after a newer event for
+// the same edge; it must not undo it
+func TestFollowRetriedAfterNewerEvent(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	base := time.Now().UnixNano()
+	followee := fmt.Sprintf("followee-%d", base)
+	follower := fmt.Sprintf("follower-%d", base)
+
+	feedCache := repository.NewFeedCache(&cache.RedisClient{Client: redis.NewClient(&redis.Options{})}, retry.DefaultPolicy)
+	registry := NewRegistry(Idempotency(repository.NewIdempotencyRepo(db)))
+	NewFeedHandlers(db, repository.NewFeedRepo(db), repository.NewFollowersRepo(db), repository.NewPostsRepo(db), feedCache, nil,
+		HandlerConfig{CelebrityThreshold: 1000}).Register(registry)
+	handler := NewEventHandler(db, repository.NewIdempotencyRepo(db), registry)
+
+	t.Cleanup(func() {
+		db.Pool.Exec(ctx, `DELETE FROM followers WHERE followee_id = $1`, followee)
+		db.Pool.Exec(ctx, `DELETE FROM follow_versions WHERE followee_id = $1`, followee)
+		db.Pool.Exec(ctx, `DELETE FROM user_stats WHERE user_id IN ($1, $2)`, follower, followee)
+		db.Pool.Exec(ctx, `DELETE FROM processed_events WHERE event_id BETWEEN $1 AND $2`, base+1, base+4)
+	})
+
+	following := func() bool {
+		var n int
+		db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM followers WHERE follower_id = $1 AND followee_id = $2`, follower, followee).Scan(&n)
+		return n == 1
+	}
+	handle := func(event *events.Event) {
+		t.Helper()
+		if err := handler.Handle(message(t, event)); err != nil {
+			t.Fatalf("%s %d: %v", event.Type, event.EventID, err)
+		}
+	}
+
+	// Follow then unfollow, with the follow deferred until after the unfollow
+	handle(events.NewFollowDeletedEvent(base+2, follower, followee))
+	handle(events.NewFollowCreatedEvent(base+1, follower, followee))
+	if following() {
+		t.Error("deferred FOLLOW_CREATED re-created an edge that was unfollowed")
+	}
+
+	// Unfollow then follow again, with the unfollow deferred
+	handle(events.NewFollowCreatedEvent(base+4, follower, followee))
+	handle(events.NewFollowDeletedEvent(base+3, follower, followee))
+	if !following() {
+		t.Error("deferred FOLLOW_DELETED dropped an edge that was followed again")
+	}
+}
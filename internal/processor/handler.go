@@ -3,131 +3,120 @@ package processor
 import (
 	"context"
 	"fmt"
-	"log"
-	"time"
 
 	"github.com/its-me-ojas/event-driven-feed/internal/events"
-	"github.com/its-me-ojas/event-driven-feed/internal/metrics"
+	"github.com/its-me-ojas/event-driven-feed/internal/failure"
 	"github.com/its-me-ojas/event-driven-feed/internal/repository"
+	"github.com/jackc/pgx/v5"
 	"github.com/segmentio/kafka-go"
 )
 
+// EventHandler turns Kafka messages into events and dispatches them, one
+// transaction per event, to the handlers registered for their type
 type EventHandler struct {
-	idempotencyRepo *repository.IdempotencyRepo
-	feedRepo        *repository.FeedRepo
-	followersRepo   *repository.FollowersRepo
-	postsRepo       *repository.PostsRepo
+	db              *repository.DB
+	idempotencyRepo *repository.IdempotencyRepo // batch claims
+	registry        *Registry
 }
 
-func NewEventHandler(idem *repository.IdempotencyRepo, feed *repository.FeedRepo, followers *repository.FollowersRepo, posts *repository.PostsRepo) *EventHandler {
+func NewEventHandler(db *repository.DB, idem *repository.IdempotencyRepo, registry *Registry) *EventHandler {
 	return &EventHandler{
+		db:              db,
 		idempotencyRepo: idem,
-		feedRepo:        feed,
-		followersRepo:   followers,
-		postsRepo:       posts,
+		registry:        registry,
 	}
 }
 
-// Handle processes a single Kafka message
-func (h *EventHandler) Handle(msg kafka.Message) error {
-	// Start the timer
-	start := time.Now()
-	ctx := context.Background()
-
-	// 1. Unmarshal the event
-	event, err := events.Unmarshal(msg.Value)
-	if err != nil {
-		// If JSON is invalid, we cant process it
-		// returning error triggers retry/DLQ loop in consumer
-		return fmt.Errorf("unmarshal error: %v", err)
-	}
+// Effects collects work that must wait until the event's transaction has
+// committed (e.g. cache evictions), so readers never see data that might
+// still roll back
+type Effects struct {
+	afterCommit []func(ctx context.Context)
+	onRollback  []func(err error)
 
-	// 2. Check idempotency
-	// if we crash after writing to DB but before commiting kafka offset
-	// checking this prevents us from processing the same event twice
-	processed, err := h.idempotencyRepo.IsProcessed(ctx, event.EventID)
-	if err != nil {
-		return fmt.Errorf("idempotency check failed: %v", err)
-	}
-	if processed {
-		log.Printf("Event %d already processed, skipping", event.EventID)
-		return nil
-	}
-
-	// 3. process based on Event type
-	var processErr error // Track the error locally to decide success/failute status
-	switch event.Type {
-	case events.EventTypePostCreated:
-		processErr = h.handlePostCreated(ctx, event)
-	default:
-		log.Printf("unknown event type: %s", event.Type)
-	}
-
-	// stop timer
-	duration := time.Since(start).Seconds()
+	// Events the batch path already claimed in this transaction
+	claimed map[int64]bool
+}
 
-	// determine status for metrics
-	status := "success"
-	if processErr != nil {
-		status = "failure"
-	}
+// AfterCommit queues fn to run once the transaction has committed.
+// It is dropped if the transaction rolls back.
+func (fx *Effects) AfterCommit(fn func(ctx context.Context)) {
+	fx.afterCommit = append(fx.afterCommit, fn)
+}
 
-	// Record metrics
-	metrics.EventsProcessed.WithLabelValues(status, event.Type).Inc()
-	metrics.EventDuration.WithLabelValues(event.Type).Observe(duration)
+// OnRollback queues fn to run if the transaction fails, with the error that
+// rolled it back. A failed batch skips it: its events are handled again one
+// by one.
+func (fx *Effects) OnRollback(fn func(err error)) {
+	fx.onRollback = append(fx.onRollback, fn)
+}
 
-	// 4. Mark as processed
-	// This "locks" the event so it won't be processed again
-	if err := h.idempotencyRepo.MarkProcessed(ctx, event.EventID); err != nil {
-		return fmt.Errorf("failed to mark processed: %v", err)
+func (fx *Effects) apply(ctx context.Context) {
+	for _, fn := range fx.afterCommit {
+		fn(ctx)
 	}
-	log.Printf("Successfully processed event %d type %s", event.EventID, event.Type)
+}
 
-	if processErr != nil {
-		return processErr
+func (fx *Effects) rollback(err error) {
+	for _, fn := range fx.onRollback {
+		fn(err)
 	}
-	return nil
 }
 
-func (h *EventHandler) handlePostCreated(ctx context.Context, event *events.Event) error {
-	authorID := event.ActorID
-	postID := event.Payload.PostID
-	content := event.Payload.Content
+// Handle processes a single Kafka message
+func (h *EventHandler) Handle(msg kafka.Message) error {
+	ctx := context.Background()
 
-	post := &repository.Post{
-		PostID:    postID,
-		AuthorID:  authorID,
-		Content:   content,
-		CreatedAt: time.Unix(event.Timestamp, 0),
+	// 1. Decode the event with the codec named in the content-type header
+	// (messages without the header are JSON)
+	event, err := decode(msg)
+	if err != nil {
+		// If the payload is invalid, we cant process it
+		// a permanent error sends it straight to the DLQ
+		return classifyDecode(fmt.Errorf("unmarshal error: %w", err))
 	}
-	if err := h.postsRepo.Create(ctx, post); err != nil {
-		return fmt.Errorf("Failed to persist post: %v", err)
+
+	// Event types this build doesn't know (e.g. mid-deploy) are parked, not
+	// marked processed, so a newer processor can still apply them
+	if !h.registry.Handles(event.Type) {
+		return unknownType(event)
 	}
 
-	// for follower count
-	count, err := h.followersRepo.GetFollowerCount(ctx, authorID)
+	// 2. Apply the event in one transaction. The registry's middleware claims
+	// it there too, so a failed attempt stays retryable and a successful one
+	// can't run twice.
+	var fx Effects
+	err = h.db.WithTx(ctx, func(tx pgx.Tx) error {
+		return h.registry.dispatch(ctx, tx, event, &fx)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get follower count: %v", err)
+		fx.rollback(err)
+		return classify(err)
 	}
 
-	if count >= 10000 {
-		log.Printf("User %s is a celebrity (%d followers skipping fan out)", authorID, count)
-		return nil
-	}
+	// 3. Cache work only after the commit
+	fx.apply(ctx)
+	return nil
+}
 
-	// 1. Fetch all followers of the author
-	followers, err := h.followersRepo.GetFollowers(ctx, authorID)
+func decode(msg kafka.Message) (*events.Event, error) {
+	codec, err := events.CodecFor(headerValue(msg, events.ContentTypeHeader))
 	if err != nil {
-		return fmt.Errorf("failed to fetch followers: %v", err)
+		return nil, err
 	}
+	return codec.Decode(msg.Value)
+}
 
-	if len(followers) == 0 {
-		return nil
-	}
+// unknownType is returned for events without a registered handler
+func unknownType(event *events.Event) error {
+	return failure.NewUnhandled(fmt.Errorf("unknown event type %q (event %d)", event.Type, event.EventID))
+}
 
-	// 2. Add post to all followers' feed (Batch Insert)
-	if err := h.feedRepo.AddToFeedBatch(ctx, followers, postID); err != nil {
-		return fmt.Errorf("feed fan-out failed: %v", err)
+func headerValue(msg kafka.Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
 	}
-	return nil
+	return ""
 }
@@ -0,0 +1,77 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/its-me-ojas/event-driven-feed/internal/events"
+	"github.com/its-me-ojas/event-driven-feed/internal/metrics"
+	"github.com/its-me-ojas/event-driven-feed/internal/repository"
+	"github.com/jackc/pgx/v5"
+)
+
+// Idempotency claims each event in processed_events before running the
+// handler. The claim commits or rolls back with the handler's writes, so an
+// event is applied exactly once; an already claimed event is skipped.
+// Events HandleBatch claimed for the whole batch are not claimed again.
+func Idempotency(repo *repository.IdempotencyRepo) Middleware {
+	return func(next EventTypeHandler) EventTypeHandler {
+		return HandlerFunc(func(ctx context.Context, tx pgx.Tx, event *events.Event, fx *Effects) error {
+			if fx.claimed[event.EventID] {
+				return next.Handle(ctx, tx, event, fx)
+			}
+			claimed, err := repo.MarkProcessed(ctx, tx, event.EventID)
+			if err != nil {
+				return fmt.Errorf("idempotency check failed: %w", err)
+			}
+			if !claimed {
+				log.Printf("Event %d already processed, skipping", event.EventID)
+				return nil
+			}
+			return next.Handle(ctx, tx, event, fx)
+		})
+	}
+}
+
+// Metrics records the processed count and duration of each event by type.
+// The outcome is recorded once the transaction has committed or rolled back,
+// so an event whose commit (or batch) fails is never counted as a success.
+func Metrics() Middleware {
+	return func(next EventTypeHandler) EventTypeHandler {
+		return HandlerFunc(func(ctx context.Context, tx pgx.Tx, event *events.Event, fx *Effects) error {
+			start := time.Now()
+			err := next.Handle(ctx, tx, event, fx)
+			elapsed := time.Since(start)
+
+			record := func(status string) {
+				metrics.EventsProcessed.WithLabelValues(status, event.Type).Inc()
+				metrics.EventDuration.WithLabelValues(event.Type).Observe(elapsed.Seconds())
+			}
+			fx.AfterCommit(func(context.Context) { record("success") })
+			fx.OnRollback(func(error) { record("failure") })
+			return err
+		})
+	}
+}
+
+// Tracing logs one line per event with its ID, type, duration and outcome,
+// once the outcome is known
+func Tracing() Middleware {
+	return func(next EventTypeHandler) EventTypeHandler {
+		return HandlerFunc(func(ctx context.Context, tx pgx.Tx, event *events.Event, fx *Effects) error {
+			start := time.Now()
+			err := next.Handle(ctx, tx, event, fx)
+			elapsed := time.Since(start)
+
+			fx.AfterCommit(func(context.Context) {
+				log.Printf("Processed event %d type %s in %v", event.EventID, event.Type, elapsed)
+			})
+			fx.OnRollback(func(txErr error) {
+				log.Printf("Event %d type %s failed after %v: %v", event.EventID, event.Type, elapsed, txErr)
+			})
+			return err
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/its-me-ojas/event-driven-feed/internal/events"
+	"github.com/jackc/pgx/v5"
+)
+
+// EventTypeHandler applies one event type inside the event's transaction.
+// Work that must wait for the commit goes through fx.AfterCommit.
+type EventTypeHandler interface {
+	Handle(ctx context.Context, tx pgx.Tx, event *events.Event, fx *Effects) error
+}
+
+// HandlerFunc adapts a function to EventTypeHandler
+type HandlerFunc func(ctx context.Context, tx pgx.Tx, event *events.Event, fx *Effects) error
+
+func (f HandlerFunc) Handle(ctx context.Context, tx pgx.Tx, event *events.Event, fx *Effects) error {
+	return f(ctx, tx, event, fx)
+}
+
+// Middleware wraps every registered handler, e.g. for idempotency or metrics
+type Middleware func(next EventTypeHandler) EventTypeHandler
+
+// Registry maps event types to their handlers. New event types plug in with
+// Register; the dispatch code in EventHandler never changes.
+type Registry struct {
+	handlers   map[string]EventTypeHandler
+	middleware []Middleware
+}
+
+// NewRegistry creates a registry whose handlers are all wrapped in middleware.
+// The first middleware is the outermost.
+func NewRegistry(middleware ...Middleware) *Registry {
+	return &Registry{
+		handlers:   make(map[string]EventTypeHandler),
+		middleware: middleware,
+	}
+}
+
+// Register adds the handler for eventType. Registering a type twice panics,
+// since it would silently replace the first handler.
+func (r *Registry) Register(eventType string, h EventTypeHandler) {
+	if _, ok := r.handlers[eventType]; ok {
+		panic(fmt.Sprintf("processor: handler for %s registered twice", eventType))
+	}
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		h = r.middleware[i](h)
+	}
+	r.handlers[eventType] = h
+}
+
+// Handles reports whether a handler is registered for eventType
+func (r *Registry) Handles(eventType string) bool {
+	_, ok := r.handlers[eventType]
+	return ok
+}
+
+// dispatch runs the handler registered for the event's type inside tx
+func (r *Registry) dispatch(ctx context.Context, tx pgx.Tx, event *events.Event, fx *Effects) error {
+	h, ok := r.handlers[event.Type]
+	if !ok {
+		return unknownType(event)
+	}
+	return h.Handle(ctx, tx, event, fx)
+}
@@ -2,17 +2,25 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/its-me-ojas/event-driven-feed/internal/breaker"
+	"github.com/its-me-ojas/event-driven-feed/internal/retry"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type DB struct {
-	Pool *pgxpool.Pool
+	Pool    *pgxpool.Pool
+	Breaker *breaker.Breaker // opens while Postgres is unreachable
+	retry   retry.Policy     // applied to transient failures of standalone queries
 }
 
-func NewDB(ctx context.Context, databaseURL string) (*DB, error) {
+func NewDB(ctx context.Context, databaseURL string, policy retry.Policy, breakerCfg breaker.Config) (*DB, error) {
 	config, err := pgxpool.ParseConfig(databaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("parse config: %v", err)
@@ -32,8 +40,13 @@ func NewDB(ctx context.Context, databaseURL string) (*DB, error) {
 		return nil, fmt.Errorf("ping: %v", err)
 	}
 
+	policy.Retryable = transient
+	breakerCfg.IsFailure = unavailable
+	breakerCfg.Probe = pool.Ping
 	return &DB{
-		Pool: pool,
+		Pool:    pool,
+		Breaker: breaker.New(breakerCfg),
+		retry:   policy,
 	}, nil
 
 }
@@ -41,3 +54,64 @@ func NewDB(ctx context.Context, databaseURL string) (*DB, error) {
 func (db *DB) Close() {
 	db.Pool.Close()
 }
+
+// WithTx runs fn inside a transaction, committing if fn returns nil and rolling back otherwise
+func (db *DB) WithTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	var tx pgx.Tx
+	err := db.withRetry(ctx, func() (err error) {
+		tx, err = db.Pool.Begin(ctx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// withRetry retries a standalone query on transient failures. Queries inside
+// a transaction are not retried here: the failed transaction is aborted, so
+// the whole unit of work is retried by its caller instead.
+// Each attempt goes through the circuit breaker, which fails fast with
+// breaker.ErrOpen while Postgres is down.
+func (db *DB) withRetry(ctx context.Context, fn func() error) error {
+	return retry.Do(ctx, db.retry, func() error {
+		return db.Breaker.Do(fn)
+	})
+}
+
+// transient reports errors worth retrying: dropped or refused connections,
+// timeouts, serialization failures and deadlocks. Query errors and missing
+// rows are returned straight away.
+func transient(err error) bool {
+	if errors.Is(err, pgx.ErrNoRows) || errors.Is(err, context.Canceled) || errors.Is(err, breaker.ErrOpen) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Class 08: connection exception, 40001: serialization failure, 40P01: deadlock
+		return strings.HasPrefix(pgErr.Code, "08") || pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+	// Anything else failed before reaching Postgres (network, pool, timeout)
+	return true
+}
+
+// unavailable reports errors that mean Postgres itself is down or refusing
+// work, as opposed to a bad query. These count towards opening the breaker.
+func unavailable(err error) bool {
+	if err == nil || errors.Is(err, pgx.ErrNoRows) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Class 08: connection exception, class 53: insufficient resources,
+		// class 57P: operator intervention (shutdown, cannot connect now)
+		return strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "53") || strings.HasPrefix(pgErr.Code, "57P")
+	}
+	// No server response at all (network, pool acquire, timeout)
+	return true
+}
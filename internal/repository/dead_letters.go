@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Dead letter statuses
+const (
+	DeadLetterPending   = "pending"   // waiting for someone to look at it
+	DeadLetterReplayed  = "replayed"  // republished from the admin API
+	DeadLetterDiscarded = "discarded" // dropped on purpose
+)
+
+// DeadLetterHeader is one Kafka header, kept in order in a JSONB array
+type DeadLetterHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// DeadLetter is a message copied from the DLQ topic
+type DeadLetter struct {
+	ID            int64
+	Topic         string // DLQ topic the message was read from
+	Partition     int
+	Offset        int64
+	Key           []byte
+	Payload       []byte
+	Headers       []DeadLetterHeader
+	OriginalTopic string
+	Error         string
+	ErrorReason   string
+	Attempts      int
+	Status        string
+	FailedAt      *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+const deadLetterColumns = `
+	id, topic, partition, kafka_offset, message_key, payload, headers, original_topic,
+	error, error_reason, attempts, status, failed_at, created_at, updated_at`
+
+type DeadLetterRepo struct {
+	db *DB
+}
+
+func NewDeadLetterRepo(db *DB) *DeadLetterRepo {
+	return &DeadLetterRepo{db: db}
+}
+
+// Insert stores a dead letter. A message already stored (same topic, partition
+// and offset) is left as is and reported as not inserted.
+func (r *DeadLetterRepo) Insert(ctx context.Context, dl *DeadLetter) (bool, error) {
+	query := `
+	INSERT INTO dead_letters (topic,partition,kafka_offset,message_key,payload,headers,original_topic,error,error_reason,attempts,failed_at)
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
+	ON CONFLICT (topic,partition,kafka_offset) DO NOTHING`
+	var inserted bool
+	err := r.db.withRetry(ctx, func() error {
+		tag, err := r.db.Pool.Exec(ctx, query, dl.Topic, dl.Partition, dl.Offset, dl.Key, dl.Payload, dl.Headers,
+			dl.OriginalTopic, dl.Error, dl.ErrorReason, dl.Attempts, dl.FailedAt)
+		if err != nil {
+			return err
+		}
+		inserted = tag.RowsAffected() == 1
+		return nil
+	})
+	return inserted, err
+}
+
+// List returns up to limit dead letters with id > afterID in id order.
+// An empty status matches every status.
+func (r *DeadLetterRepo) List(ctx context.Context, status string, afterID int64, limit int) ([]DeadLetter, error) {
+	query := `SELECT` + deadLetterColumns + `
+	FROM dead_letters WHERE ($1 = '' OR status = $1) AND id > $2 ORDER BY id LIMIT $3`
+	var letters []DeadLetter
+	err := r.db.withRetry(ctx, func() error {
+		rows, err := r.db.Pool.Query(ctx, query, status, afterID, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		letters = letters[:0]
+		for rows.Next() {
+			dl, err := scanDeadLetter(rows)
+			if err != nil {
+				return err
+			}
+			letters = append(letters, dl)
+		}
+		return rows.Err()
+	})
+	return letters, err
+}
+
+// Get returns one dead letter, or pgx.ErrNoRows
+func (r *DeadLetterRepo) Get(ctx context.Context, id int64) (*DeadLetter, error) {
+	query := `SELECT` + deadLetterColumns + ` FROM dead_letters WHERE id = $1`
+	var dl DeadLetter
+	err := r.db.withRetry(ctx, func() error {
+		var err error
+		dl, err = scanDeadLetter(r.db.Pool.QueryRow(ctx, query, id))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dl, nil
+}
+
+// GetForUpdate returns one dead letter and locks its row until tx ends,
+// so two admins can't act on the same entry at once
+func (r *DeadLetterRepo) GetForUpdate(ctx context.Context, tx pgx.Tx, id int64) (*DeadLetter, error) {
+	query := `SELECT` + deadLetterColumns + ` FROM dead_letters WHERE id = $1 FOR UPDATE`
+	dl, err := scanDeadLetter(tx.QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, err
+	}
+	return &dl, nil
+}
+
+// SetStatus changes a dead letter's status inside tx
+func (r *DeadLetterRepo) SetStatus(ctx context.Context, tx pgx.Tx, id int64, status string) error {
+	query := `UPDATE dead_letters SET status = $2, updated_at = NOW() WHERE id = $1`
+	_, err := tx.Exec(ctx, query, id, status)
+	return err
+}
+
+func scanDeadLetter(row pgx.Row) (DeadLetter, error) {
+	var dl DeadLetter
+	err := row.Scan(&dl.ID, &dl.Topic, &dl.Partition, &dl.Offset, &dl.Key, &dl.Payload, &dl.Headers, &dl.OriginalTopic,
+		&dl.Error, &dl.ErrorReason, &dl.Attempts, &dl.Status, &dl.FailedAt, &dl.CreatedAt, &dl.UpdatedAt)
+	return dl, err
+}
@@ -3,27 +3,39 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/its-me-ojas/event-driven-feed/internal/cache"
+	"github.com/its-me-ojas/event-driven-feed/internal/retry"
 	"github.com/redis/go-redis/v9"
 )
 
 type FeedCache struct {
 	client *cache.RedisClient
+	retry  retry.Policy
 }
 
-func NewFeedCache(client *cache.RedisClient) *FeedCache {
+func NewFeedCache(client *cache.RedisClient, policy retry.Policy) *FeedCache {
+	// A cache miss is an answer, not a failure
+	policy.Retryable = func(err error) bool {
+		return !errors.Is(err, redis.Nil) && !errors.Is(err, context.Canceled)
+	}
 	return &FeedCache{
 		client: client,
+		retry:  policy,
 	}
 }
 
 // GetFeed attempts to fetch the feed from Redis
 func (c *FeedCache) GetFeed(ctx context.Context, userID string) ([]int64, error) {
 	key := fmt.Sprintf("feed:%s", userID)
-	val, err := c.client.Client.Get(ctx, key).Result()
+	var val string
+	err := retry.Do(ctx, c.retry, func() (err error) {
+		val, err = c.client.Client.Get(ctx, key).Result()
+		return err
+	})
 	if err == redis.Nil {
 		return nil, nil // Cache miss
 	}
@@ -45,11 +57,51 @@ func (c *FeedCache) SetFeed(ctx context.Context, userID string, postIDs []int64)
 		return err
 	}
 	// Cache for 5 minutes
-	return c.client.Client.Set(ctx, key, data, 5*time.Minute).Err()
+	return retry.Do(ctx, c.retry, func() error {
+		return c.client.Client.Set(ctx, key, data, 5*time.Minute).Err()
+	})
 }
 
-// InvalidateFeed removes a user's feed from cache (used when new posts arrive)
+// InvalidateFeed removes a user's feed from cache (used when posts leave a feed)
 func (c *FeedCache) InvalidateFeed(ctx context.Context, userID string) error {
 	key := fmt.Sprintf("feed:%s", userID)
-	return c.client.Client.Del(ctx, key).Err()
+	return retry.Do(ctx, c.retry, func() error {
+		return c.client.Client.Del(ctx, key).Err()
+	})
+}
+
+// pushToFeed prepends a post to a cached feed, dropping the oldest entries past
+// ARGV[2], and keeps the key's TTL. Only feeds already cached are touched: the
+// cache holds whole first pages, so a missing key stays a miss. IDs are handled
+// as strings because Lua numbers can't hold a snowflake ID exactly.
+var pushToFeed = redis.NewScript(`
+local val = redis.call('GET', KEYS[1])
+if not val then return 0 end
+local ids = {ARGV[1]}
+for id in string.gmatch(val, '%-?%d+') do
+	if id == ARGV[1] then return 0 end
+	if #ids < tonumber(ARGV[2]) then ids[#ids + 1] = id end
+end
+redis.call('SET', KEYS[1], '[' .. table.concat(ids, ',') .. ']', 'KEEPTTL')
+return 1
+`)
+
+// PushToFeeds writes a new post through to the cached feeds of userIDs,
+// trimmed to maxLen posts, in one pipeline
+func (c *FeedCache) PushToFeeds(ctx context.Context, userIDs []string, postID int64, maxLen int) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	return retry.Do(ctx, c.retry, func() error {
+		// Load once so the pipeline can use EVALSHA
+		if err := pushToFeed.Load(ctx, c.client.Client).Err(); err != nil {
+			return err
+		}
+		pipe := c.client.Client.Pipeline()
+		for _, userID := range userIDs {
+			pushToFeed.EvalSha(ctx, pipe, []string{fmt.Sprintf("feed:%s", userID)}, postID, maxLen)
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	})
 }
@@ -2,10 +2,18 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 )
 
+// FeedItem is one post in a feed along with the time it was posted
+type FeedItem struct {
+	PostID    int64
+	CreatedAt time.Time
+}
+
 type FeedRepo struct {
 	db *DB
 }
@@ -21,45 +29,172 @@ func (r *FeedRepo) AddToFeed(ctx context.Context, userID string, postID int64) e
 	return err
 }
 
-func (r *FeedRepo) AddToFeedBatch(ctx context.Context, userIDs []string, postID int64) error {
+// AddToFeedChunk inserts postID into a chunk of feeds with a single unnest insert
+func (r *FeedRepo) AddToFeedChunk(ctx context.Context, tx pgx.Tx, userIDs []string, postID int64) error {
 	if len(userIDs) == 0 {
 		return nil
 	}
+	query := `
+	INSERT INTO feeds (user_id,post_id,created_at)
+	SELECT u, $2, NOW() FROM unnest($1::varchar[]) AS u
+	ON CONFLICT DO NOTHING`
+	_, err := tx.Exec(ctx, query, userIDs, postID)
+	return err
+}
+
+// FanoutCheckpoint is the progress of a fan-out that spans several chunks
+type FanoutCheckpoint struct {
+	EventID        int64 // the POST_CREATED event being fanned out
+	PostID         int64
+	AuthorID       string
+	LastFollowerID string // the next chunk starts after this follower
+	NextChunk      int
+}
+
+// SaveFanoutCheckpoint records how far a fan-out has got, inside the tx that
+// wrote the chunk
+func (r *FeedRepo) SaveFanoutCheckpoint(ctx context.Context, tx pgx.Tx, cp *FanoutCheckpoint) error {
+	query := `
+	INSERT INTO fanout_checkpoints (event_id,post_id,author_id,last_follower_id,next_chunk,updated_at)
+	VALUES ($1,$2,$3,$4,$5,NOW())
+	ON CONFLICT (event_id) DO UPDATE
+	SET last_follower_id = EXCLUDED.last_follower_id, next_chunk = EXCLUDED.next_chunk, updated_at = NOW()`
+	_, err := tx.Exec(ctx, query, cp.EventID, cp.PostID, cp.AuthorID, cp.LastFollowerID, cp.NextChunk)
+	return err
+}
 
-	batch := &pgx.Batch{}
-	for _, userID := range userIDs {
-		batch.Queue(
-			`INSERT INTO feeds (user_id,post_id,created_at) VALUES ($1,$2,NOW()) ON CONFLICT DO NOTHING`, userID, postID)
+// LockFanoutCheckpoint returns an event's checkpoint locked until tx ends. It
+// returns nil if the fan-out has finished or another worker is writing its
+// next chunk.
+func (r *FeedRepo) LockFanoutCheckpoint(ctx context.Context, tx pgx.Tx, eventID int64) (*FanoutCheckpoint, error) {
+	query := `
+	SELECT event_id, post_id, author_id, last_follower_id, next_chunk
+	FROM fanout_checkpoints WHERE event_id = $1 FOR UPDATE SKIP LOCKED`
+	var cp FanoutCheckpoint
+	err := tx.QueryRow(ctx, query, eventID).Scan(&cp.EventID, &cp.PostID, &cp.AuthorID, &cp.LastFollowerID, &cp.NextChunk)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
+	return &cp, nil
+}
 
-	results := r.db.Pool.SendBatch(ctx, batch)
-	defer results.Close()
+// ClearFanoutCheckpoint drops an event's checkpoint once its fan-out has finished
+func (r *FeedRepo) ClearFanoutCheckpoint(ctx context.Context, tx pgx.Tx, eventID int64) error {
+	_, err := tx.Exec(ctx, `DELETE FROM fanout_checkpoints WHERE event_id = $1`, eventID)
+	return err
+}
+
+// CancelFanouts stops any fan-out still running for a post. It waits for a
+// chunk being written to commit, so the caller sees that chunk's feed rows.
+func (r *FeedRepo) CancelFanouts(ctx context.Context, tx pgx.Tx, postID int64) error {
+	_, err := tx.Exec(ctx, `DELETE FROM fanout_checkpoints WHERE post_id = $1`, postID)
+	return err
+}
 
-	for range userIDs {
-		if _, err := results.Exec(); err != nil {
+// StaleFanouts returns up to limit events whose fan-out checkpoint hasn't
+// moved for olderThan, i.e. whose worker stopped part way
+func (r *FeedRepo) StaleFanouts(ctx context.Context, olderThan time.Duration, limit int) ([]int64, error) {
+	query := `
+	SELECT event_id FROM fanout_checkpoints
+	WHERE updated_at < NOW() - make_interval(secs => $1) ORDER BY updated_at LIMIT $2`
+	var eventIDs []int64
+	err := r.db.withRetry(ctx, func() error {
+		rows, err := r.db.Pool.Query(ctx, query, olderThan.Seconds(), limit)
+		if err != nil {
 			return err
 		}
+		defer rows.Close()
+
+		eventIDs = eventIDs[:0]
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			eventIDs = append(eventIDs, id)
+		}
+		return rows.Err()
+	})
+	return eventIDs, err
+}
+
+// BackfillFeed adds existing posts to one user's feed, keeping each post's
+// original timestamp so older posts don't jump to the top of the feed
+func (r *FeedRepo) BackfillFeed(ctx context.Context, tx pgx.Tx, userID string, posts []*Post) error {
+	if len(posts) == 0 {
+		return nil
 	}
 
-	return nil
+	postIDs := make([]int64, len(posts))
+	createdAt := make([]time.Time, len(posts))
+	for i, post := range posts {
+		postIDs[i] = post.PostID
+		createdAt[i] = post.CreatedAt
+	}
+
+	query := `
+	INSERT INTO feeds (user_id,post_id,created_at)
+	SELECT $1, p, c FROM unnest($2::bigint[], $3::timestamp[]) AS t(p, c)
+	ON CONFLICT DO NOTHING`
+	_, err := tx.Exec(ctx, query, userID, postIDs, createdAt)
+	return err
+}
+
+// RemoveAuthorFromFeed deletes every post by authorID from a user's feed
+func (r *FeedRepo) RemoveAuthorFromFeed(ctx context.Context, tx pgx.Tx, userID, authorID string) error {
+	query := `DELETE FROM feeds f USING posts p WHERE f.post_id = p.post_id AND f.user_id = $1 AND p.author_id = $2`
+	_, err := tx.Exec(ctx, query, userID, authorID)
+	return err
+}
+
+// GetFeed returns a page of a user's feed ordered by when each post was
+// written, not when it was fanned out, so it merges cleanly with posts read
+// straight from the posts table
+func (r *FeedRepo) GetFeed(ctx context.Context, userID string, limit, offset int) ([]FeedItem, error) {
+	query := `
+	SELECT f.post_id, p.created_at FROM feeds f JOIN posts p ON p.post_id = f.post_id
+	WHERE f.user_id=$1 ORDER BY p.created_at DESC, f.post_id DESC LIMIT $2 OFFSET $3`
+	var items []FeedItem
+	err := r.db.withRetry(ctx, func() error {
+		rows, err := r.db.Pool.Query(ctx, query, userID, limit, offset)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
 
+		items = items[:0]
+		for rows.Next() {
+			var item FeedItem
+			if err := rows.Scan(&item.PostID, &item.CreatedAt); err != nil {
+				return err
+			}
+			items = append(items, item)
+		}
+		return rows.Err()
+	})
+	return items, err
 }
 
-func (r *FeedRepo) GetFeed(ctx context.Context, userID string, limit, offset int) ([]int64, error) {
-	query := `SELECT post_id FROM feeds WHERE user_id=$1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
-	rows, err := r.db.Pool.Query(ctx, query, userID, limit, offset)
+// RemoveFromFeeds deletes a post from every feed it was fanned out to and
+// returns the users whose feeds changed
+func (r *FeedRepo) RemoveFromFeeds(ctx context.Context, tx pgx.Tx, postID int64) ([]string, error) {
+	query := `DELETE FROM feeds WHERE post_id=$1 RETURNING user_id`
+	rows, err := tx.Query(ctx, query, postID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var postIDs []int64
+	var userIDs []string
 	for rows.Next() {
-		var postID int64
-		if err := rows.Scan(&postID); err != nil {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
 			return nil, err
 		}
-		postIDs = append(postIDs, postID)
+		userIDs = append(userIDs, userID)
 	}
-	return postIDs, rows.Err()
+	return userIDs, rows.Err()
 }
@@ -2,6 +2,9 @@ package repository
 
 import (
 	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type FollowersRepo struct {
@@ -12,9 +15,11 @@ func NewFollowersRepo(db *DB) *FollowersRepo {
 	return &FollowersRepo{db: db}
 }
 
-func (r *FollowersRepo) GetFollowers(ctx context.Context, userID string) ([]string, error) {
-	query := `SELECT follower_id FROM followers WHERE followee_id = $1`
-	rows, err := r.db.Pool.Query(ctx, query, userID)
+// GetFollowersPage returns up to limit followers of userID ordered by follower_id,
+// starting after the given cursor ("" for the first page)
+func (r *FollowersRepo) GetFollowersPage(ctx context.Context, tx pgx.Tx, userID, after string, limit int) ([]string, error) {
+	query := `SELECT follower_id FROM followers WHERE followee_id = $1 AND follower_id > $2 ORDER BY follower_id LIMIT $3`
+	rows, err := tx.Query(ctx, query, userID, after, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -31,39 +36,143 @@ func (r *FollowersRepo) GetFollowers(ctx context.Context, userID string) ([]stri
 	return followers, rows.Err()
 }
 
-func (r *FollowersRepo) Follow(ctx context.Context, followerID, followeeID string) error {
-	query := `INSERT INTO followers (follower_id, followee_id, created_at) VALUES ($1, $2, NOW()) ON CONFLICT DO NOTHING`
-	_, err := r.db.Pool.Exec(ctx, query, followerID, followeeID)
-	return err
+// ClaimFollowVersion records eventID as the last follow or unfollow applied to
+// the edge, within tx. Follow events are ordered by event ID like edits, so
+// an event older than the last applied one is reported as false and must be
+// skipped.
+func (r *FollowersRepo) ClaimFollowVersion(ctx context.Context, tx pgx.Tx, followerID, followeeID string, eventID int64) (bool, error) {
+	query := `
+	INSERT INTO follow_versions (follower_id,followee_id,last_event_id) VALUES ($1,$2,$3)
+	ON CONFLICT (follower_id,followee_id) DO UPDATE SET last_event_id = EXCLUDED.last_event_id
+	WHERE follow_versions.last_event_id < EXCLUDED.last_event_id
+	RETURNING last_event_id`
+	var applied int64
+	err := tx.QueryRow(ctx, query, followerID, followeeID, eventID).Scan(&applied)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
-func (r *FollowersRepo) GetFollowerCount(ctx context.Context, userID string) (int, error) {
-	query := `SELECT COUNT(*) FROM followers WHERE followee_id = $1`
-	var count int
-	err := r.db.Pool.QueryRow(ctx, query, userID).Scan(&count)
+// Follow inserts the edge and bumps both users' counts in user_stats within tx
+func (r *FollowersRepo) Follow(ctx context.Context, tx pgx.Tx, followerID, followeeID string) error {
+	query := `INSERT INTO followers (follower_id, followee_id, created_at) VALUES ($1, $2, NOW()) ON CONFLICT DO NOTHING`
+	tag, err := tx.Exec(ctx, query, followerID, followeeID)
 	if err != nil {
-		return 0, err
+		return err
 	}
-	return count, nil
+	// Already following: counts are unchanged
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+	return adjustStats(ctx, tx, followerID, followeeID, 1)
 }
 
-func (r *FollowersRepo) GetCelebrityFollowees(ctx context.Context, userID string) ([]string, error) {
-	query := `SELECT f.followee_id FROM followers f JOIN ( SELECT followee_id, COUNT(*) as cnt FROM followers GROUP BY followee_id) counts ON f.followee_id = counts.followee_id WHERE f.follower_id = $1 AND counts.cnt >=100`
-	rows, err := r.db.Pool.Query(ctx, query, userID)
+// Unfollow deletes the edge and decrements both users' counts within tx
+func (r *FollowersRepo) Unfollow(ctx context.Context, tx pgx.Tx, followerID, followeeID string) error {
+	query := `DELETE FROM followers WHERE follower_id = $1 AND followee_id = $2`
+	tag, err := tx.Exec(ctx, query, followerID, followeeID)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
 	}
+	return adjustStats(ctx, tx, followerID, followeeID, -1)
+}
 
-	defer rows.Close()
+// adjustStats applies delta to the followee's follower_count and the follower's following_count
+func adjustStats(ctx context.Context, tx pgx.Tx, followerID, followeeID string, delta int) error {
+	followers := `
+	INSERT INTO user_stats (user_id, follower_count, updated_at) VALUES ($1, GREATEST($2, 0), NOW())
+	ON CONFLICT (user_id) DO UPDATE SET follower_count = GREATEST(user_stats.follower_count + $2, 0), updated_at = NOW()`
+	following := `
+	INSERT INTO user_stats (user_id, following_count, updated_at) VALUES ($1, GREATEST($2, 0), NOW())
+	ON CONFLICT (user_id) DO UPDATE SET following_count = GREATEST(user_stats.following_count + $2, 0), updated_at = NOW()`
 
-	var ids []string
-	for rows.Next() {
-		var id string
-		if err := rows.Scan(&id); err != nil {
-			return nil, err
+	updates := []struct {
+		userID, query string
+	}{
+		{followeeID, followers},
+		{followerID, following},
+	}
+	// Touch the rows in user_id order: A->B and B->A run on different workers
+	// and would otherwise lock the same two rows in opposite orders (40P01)
+	if followerID < followeeID {
+		updates[0], updates[1] = updates[1], updates[0]
+	}
+	for _, u := range updates {
+		if _, err := tx.Exec(ctx, u.query, u.userID, delta); err != nil {
+			return err
 		}
-		ids = append(ids, id)
 	}
-	return ids, nil
+	return nil
+}
+
+// GetFollowerCount reads the denormalized count from user_stats
+func (r *FollowersRepo) GetFollowerCount(ctx context.Context, tx pgx.Tx, userID string) (int, error) {
+	query := `SELECT follower_count FROM user_stats WHERE user_id = $1`
+	var count int
+	err := tx.QueryRow(ctx, query, userID).Scan(&count)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
 
+// GetCelebrityFollowees returns the accounts userID follows that have at least threshold followers
+func (r *FollowersRepo) GetCelebrityFollowees(ctx context.Context, userID string, threshold int) ([]string, error) {
+	query := `SELECT f.followee_id FROM followers f JOIN user_stats s ON s.user_id = f.followee_id WHERE f.follower_id = $1 AND s.follower_count >= $2`
+	var ids []string
+	err := r.db.withRetry(ctx, func() error {
+		rows, err := r.db.Pool.Query(ctx, query, userID, threshold)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		ids = ids[:0]
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return rows.Err()
+	})
+	return ids, err
+
+}
+
+// ReconcileStats recomputes user_stats from the followers table and
+// returns the number of rows that had drifted
+func (r *FollowersRepo) ReconcileStats(ctx context.Context) (int64, error) {
+	query := `
+	WITH actual AS (
+		SELECT user_id, SUM(followers)::BIGINT AS follower_count, SUM(following)::BIGINT AS following_count FROM (
+			SELECT followee_id AS user_id, COUNT(*) AS followers, 0 AS following FROM followers GROUP BY followee_id
+			UNION ALL
+			SELECT follower_id AS user_id, 0 AS followers, COUNT(*) AS following FROM followers GROUP BY follower_id
+			UNION ALL
+			SELECT user_id, 0, 0 FROM user_stats
+		) counts
+		GROUP BY user_id
+	)
+	INSERT INTO user_stats (user_id, follower_count, following_count, updated_at)
+	SELECT user_id, follower_count, following_count, NOW() FROM actual
+	ON CONFLICT (user_id) DO UPDATE
+		SET follower_count = EXCLUDED.follower_count, following_count = EXCLUDED.following_count, updated_at = NOW()
+		WHERE user_stats.follower_count <> EXCLUDED.follower_count OR user_stats.following_count <> EXCLUDED.following_count`
+	tag, err := r.db.Pool.Exec(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
 }
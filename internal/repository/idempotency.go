@@ -2,7 +2,6 @@ package repository
 
 import (
 	"context"
-	"errors"
 
 	"github.com/jackc/pgx/v5"
 )
@@ -15,21 +14,40 @@ func NewIdempotencyRepo(db *DB) *IdempotencyRepo {
 	return &IdempotencyRepo{db: db}
 }
 
-func (r *IdempotencyRepo) IsProcessed(ctx context.Context, eventID int64) (bool, error) {
-	query := `SELECT 1 FROM processed_events WHERE event_id = $1`
-	var exists int
-	err := r.db.Pool.QueryRow(ctx, query, eventID).Scan(&exists)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return false, nil
-	}
+// MarkProcessed claims an event inside tx. It returns false if the event was
+// already processed. The claim commits or rolls back with the event's side
+// effects, and a concurrent attempt on the same event blocks on the row until
+// this transaction finishes.
+func (r *IdempotencyRepo) MarkProcessed(ctx context.Context, tx pgx.Tx, eventID int64) (bool, error) {
+	query := `INSERT INTO processed_events (event_id, processed_at) VALUES ($1, NOW()) ON CONFLICT DO NOTHING`
+	tag, err := tx.Exec(ctx, query, eventID)
 	if err != nil {
 		return false, err
 	}
-	return true, nil
+	return tag.RowsAffected() == 1, nil
 }
 
-func (r *IdempotencyRepo) MarkProcessed(ctx context.Context, eventID int64) error {
-	query := `INSERT INTO processed_events (event_id, processed_at) VALUES ($1, NOW()) ON CONFLICT DO NOTHING`
-	_, err := r.db.Pool.Exec(ctx, query, eventID)
-	return err
+// MarkProcessedBatch claims several events inside tx with one statement and
+// returns the ones this call claimed; the rest were already processed. Rows
+// are claimed in event_id order so overlapping batches can't deadlock.
+func (r *IdempotencyRepo) MarkProcessedBatch(ctx context.Context, tx pgx.Tx, eventIDs []int64) (map[int64]bool, error) {
+	query := `
+	INSERT INTO processed_events (event_id, processed_at)
+	SELECT id, NOW() FROM unnest($1::bigint[]) AS id ORDER BY id
+	ON CONFLICT DO NOTHING RETURNING event_id`
+	rows, err := tx.Query(ctx, query, eventIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claimed := make(map[int64]bool, len(eventIDs))
+	for rows.Next() {
+		var eventID int64
+		if err := rows.Scan(&eventID); err != nil {
+			return nil, err
+		}
+		claimed[eventID] = true
+	}
+	return claimed, rows.Err()
 }
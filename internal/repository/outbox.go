@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// outboxRelayLock is the advisory lock key held by the relay publishing the outbox
+const outboxRelayLock = 7_000_001
+
+// outboxKeyLockClass is the first half of the two-part advisory lock taken
+// per partition key when adding entries (two-part keys never clash with
+// outboxRelayLock)
+const outboxKeyLockClass = 7_000_002
+
+// OutboxEntry is an encoded event waiting to be published
+type OutboxEntry struct {
+	ID           int64
+	EventID      int64  // 0 for entries without an event id, e.g. feed updates
+	Topic        string // empty means the relay's default topic
+	PartitionKey string
+	ContentType  string
+	Payload      []byte
+	CreatedAt    time.Time
+}
+
+type OutboxRepo struct {
+	db *DB
+}
+
+func NewOutboxRepo(db *DB) *OutboxRepo {
+	return &OutboxRepo{db: db}
+}
+
+// Add stores an event inside tx, so it is published only if tx commits.
+// The relay publishes in id order, but ids are handed out before commit, so
+// two transactions for the same key could commit out of order and be
+// published that way. Add takes a lock on the topic and key first, held
+// until tx ends, so a key's next entry only gets its id once the previous
+// one has committed.
+func (r *OutboxRepo) Add(ctx context.Context, tx pgx.Tx, entry *OutboxEntry) error {
+	lock := `SELECT pg_advisory_xact_lock($1::int, hashtext($2::text || '/' || $3::text))`
+	if _, err := tx.Exec(ctx, lock, outboxKeyLockClass, entry.Topic, entry.PartitionKey); err != nil {
+		return err
+	}
+	query := `INSERT INTO outbox (event_id,topic,partition_key,content_type,payload) VALUES (NULLIF($1,0),$2,$3,$4,$5)`
+	_, err := tx.Exec(ctx, query, entry.EventID, entry.Topic, entry.PartitionKey, entry.ContentType, entry.Payload)
+	return err
+}
+
+// LockRelay takes a transaction-scoped advisory lock. It returns false if
+// another relay holds it, so only one publishes at a time and order is kept.
+func (r *OutboxRepo) LockRelay(ctx context.Context, tx pgx.Tx) (bool, error) {
+	var locked bool
+	err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, outboxRelayLock).Scan(&locked)
+	return locked, err
+}
+
+// FetchUnsent returns the oldest unsent entries in id order
+func (r *OutboxRepo) FetchUnsent(ctx context.Context, tx pgx.Tx, limit int) ([]OutboxEntry, error) {
+	query := `
+	SELECT id, COALESCE(event_id, 0), topic, partition_key, content_type, payload, created_at
+	FROM outbox WHERE sent_at IS NULL ORDER BY id LIMIT $1`
+	rows, err := tx.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []OutboxEntry
+	for rows.Next() {
+		var e OutboxEntry
+		if err := rows.Scan(&e.ID, &e.EventID, &e.Topic, &e.PartitionKey, &e.ContentType, &e.Payload, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// MarkSent records that entries were published
+func (r *OutboxRepo) MarkSent(ctx context.Context, tx pgx.Tx, ids []int64) error {
+	query := `UPDATE outbox SET sent_at = NOW() WHERE id = ANY($1)`
+	_, err := tx.Exec(ctx, query, ids)
+	return err
+}
+
+// Lag returns the age of the oldest unsent entry, or 0 if the outbox is
+// drained. The age is computed by Postgres so clock skew doesn't matter.
+func (r *OutboxRepo) Lag(ctx context.Context) (time.Duration, error) {
+	query := `
+	SELECT COALESCE((
+		SELECT EXTRACT(EPOCH FROM NOW() - created_at)::float8
+		FROM outbox WHERE sent_at IS NULL ORDER BY id LIMIT 1
+	), 0)`
+	var seconds float64
+	err := r.db.withRetry(ctx, func() error {
+		return r.db.Pool.QueryRow(ctx, query).Scan(&seconds)
+	})
+	return time.Duration(seconds * float64(time.Second)), err
+}
+
+// PruneSent deletes entries published more than olderThan ago
+func (r *OutboxRepo) PruneSent(ctx context.Context, olderThan time.Duration) (int64, error) {
+	query := `DELETE FROM outbox WHERE sent_at < NOW() - make_interval(secs => $1)`
+	var deleted int64
+	err := r.db.withRetry(ctx, func() error {
+		tag, err := r.db.Pool.Exec(ctx, query, olderThan.Seconds())
+		if err != nil {
+			return err
+		}
+		deleted = tag.RowsAffected()
+		return nil
+	})
+	return deleted, err
+}
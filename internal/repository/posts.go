@@ -2,14 +2,22 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
+// ErrPostNotFound is returned when an edit targets a post that has not been persisted yet
+var ErrPostNotFound = errors.New("post not found")
+
 type Post struct {
-	PostID    int64
-	AuthorID  string
-	Content   string
-	CreatedAt time.Time
+	PostID        int64
+	AuthorID      string
+	Content       string
+	CreatedAt     time.Time
+	Edited        bool
+	RevisionCount int
 }
 
 type PostsRepo struct {
@@ -20,20 +28,129 @@ func NewPostsRepo(db *DB) *PostsRepo {
 	return &PostsRepo{db: db}
 }
 
-func (r *PostsRepo) Create(ctx context.Context, post *Post) error {
+// Create inserts a post. It is a no-op if the post already exists.
+func (r *PostsRepo) Create(ctx context.Context, tx pgx.Tx, post *Post) error {
 	query := `
-	INSERT INTO posts (post_id,author_id,content,created_at) VALUES ($1,$2,$3,$4)`
+	INSERT INTO posts (post_id,author_id,content,created_at) VALUES ($1,$2,$3,$4) ON CONFLICT (post_id) DO NOTHING`
 
-	_, err := r.db.Pool.Exec(ctx, query, post.PostID, post.AuthorID, post.Content, post.CreatedAt)
+	_, err := tx.Exec(ctx, query, post.PostID, post.AuthorID, post.Content, post.CreatedAt)
 	return err
 }
 
 func (r *PostsRepo) GetByID(ctx context.Context, postId int64) (*Post, error) {
-	query := `SELECT post_id, author_id, content, created_at FROM posts WHERE post_id=$1`
+	query := `
+	SELECT p.post_id, p.author_id, p.content, p.created_at,
+		(SELECT COUNT(*) FROM post_revisions pr WHERE pr.post_id = p.post_id)
+	FROM posts p WHERE p.post_id=$1`
 	var post Post
-	err := r.db.Pool.QueryRow(ctx, query, postId).Scan(&post.PostID, &post.AuthorID, &post.Content, &post.CreatedAt)
+	err := r.db.withRetry(ctx, func() error {
+		return r.db.Pool.QueryRow(ctx, query, postId).Scan(&post.PostID, &post.AuthorID, &post.Content, &post.CreatedAt, &post.RevisionCount)
+	})
 	if err != nil {
 		return nil, err
 	}
+	post.Edited = post.RevisionCount > 0
 	return &post, nil
 }
+
+// GetRecentByAuthor returns an author's newest posts (served by idx_posts_author)
+func (r *PostsRepo) GetRecentByAuthor(ctx context.Context, tx pgx.Tx, authorID string, limit int) ([]*Post, error) {
+	query := `SELECT post_id, author_id, content, created_at FROM posts WHERE author_id=$1 ORDER BY created_at DESC LIMIT $2`
+	rows, err := tx.Query(ctx, query, authorID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []*Post
+	for rows.Next() {
+		var post Post
+		if err := rows.Scan(&post.PostID, &post.AuthorID, &post.Content, &post.CreatedAt); err != nil {
+			return nil, err
+		}
+		posts = append(posts, &post)
+	}
+	return posts, rows.Err()
+}
+
+// GetRecentFeedItems returns the newest posts across several authors.
+// Used to pull celebrity posts into a feed at read time.
+func (r *PostsRepo) GetRecentFeedItems(ctx context.Context, authorIDs []string, limit int) ([]FeedItem, error) {
+	if len(authorIDs) == 0 {
+		return nil, nil
+	}
+	query := `SELECT post_id, created_at FROM posts WHERE author_id = ANY($1) ORDER BY created_at DESC, post_id DESC LIMIT $2`
+	var items []FeedItem
+	err := r.db.withRetry(ctx, func() error {
+		rows, err := r.db.Pool.Query(ctx, query, authorIDs, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		items = items[:0]
+		for rows.Next() {
+			var item FeedItem
+			if err := rows.Scan(&item.PostID, &item.CreatedAt); err != nil {
+				return err
+			}
+			items = append(items, item)
+		}
+		return rows.Err()
+	})
+	return items, err
+}
+
+// Update replaces a post's content and archives the previous version in post_revisions.
+// Edits are ordered by event ID, so an edit older than the last applied one is skipped
+// and reported as not applied. Returns ErrPostNotFound if the post does not exist yet.
+func (r *PostsRepo) Update(ctx context.Context, tx pgx.Tx, postID int64, content string, eventID int64, editedAt time.Time) (bool, error) {
+	var (
+		oldContent      string
+		versionTime     time.Time
+		lastEditEventID int64
+	)
+	query := `SELECT content, COALESCE(updated_at, created_at), last_edit_event_id FROM posts WHERE post_id=$1 FOR UPDATE`
+	err := tx.QueryRow(ctx, query, postID).Scan(&oldContent, &versionTime, &lastEditEventID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, ErrPostNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	if eventID <= lastEditEventID {
+		return false, nil
+	}
+
+	archive := `
+	INSERT INTO post_revisions (post_id,revision,content,created_at)
+	SELECT $1, COALESCE(MAX(revision),0)+1, $2, $3 FROM post_revisions WHERE post_id=$1`
+	if _, err := tx.Exec(ctx, archive, postID, oldContent, versionTime); err != nil {
+		return false, err
+	}
+
+	update := `UPDATE posts SET content=$2, updated_at=$3, last_edit_event_id=$4 WHERE post_id=$1`
+	if _, err := tx.Exec(ctx, update, postID, content, editedAt, eventID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Delete removes a post and leaves a tombstone, so events for it that arrive
+// late (e.g. a POST_CREATED from a retry tier) can tell it was deleted.
+// Deleting a post that does not exist is not an error, so a redelivered
+// POST_DELETED event is harmless.
+func (r *PostsRepo) Delete(ctx context.Context, tx pgx.Tx, postID int64) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM posts WHERE post_id=$1`, postID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `INSERT INTO deleted_posts (post_id) VALUES ($1) ON CONFLICT DO NOTHING`, postID)
+	return err
+}
+
+// IsDeleted reports whether a post has been deleted
+func (r *PostsRepo) IsDeleted(ctx context.Context, tx pgx.Tx, postID int64) (bool, error) {
+	var deleted bool
+	err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM deleted_posts WHERE post_id=$1)`, postID).Scan(&deleted)
+	return deleted, err
+}
@@ -0,0 +1,104 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/its-me-ojas/event-driven-feed/internal/failure"
+)
+
+// Policy defines how we should retry failed operations
+type Policy struct {
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64       // randomizes each wait by ±Jitter (0.2 = ±20%)
+	MaxElapsed     time.Duration // give up once the next wait would pass this budget (0 = no limit)
+
+	// Retryable decides whether an error is worth another attempt.
+	// Defaults to errors that failure.KindOf reports as Retryable.
+	Retryable func(err error) bool
+
+	// OnRetry is called before each wait, e.g. to record metrics
+	OnRetry func(attempt int, err error, wait time.Duration)
+}
+
+// DefaultPolicy provides sensible defaults
+var DefaultPolicy = Policy{
+	MaxRetries:     3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     1 * time.Second,
+	Multiplier:     2.0,
+	Jitter:         0.2,
+	MaxElapsed:     10 * time.Second,
+}
+
+// Do executes a function with retry logic based on the policy
+// It is useful for wrapping specific DB calls or external API requests
+func Do(ctx context.Context, policy Policy, fn func() error) error {
+	var err error
+	start := time.Now()
+	backoff := policy.InitialBackoff
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = func(err error) bool { return failure.KindOf(err) == failure.Retryable }
+	}
+
+	for attempt := 1; attempt <= policy.MaxRetries; attempt++ {
+		// Check if context is cancelled
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// Attempt the operation
+		if err = fn(); err == nil {
+			return nil // Success
+		}
+
+		// Errors that can't succeed on retry go straight back to the caller
+		if !retryable(err) {
+			return err
+		}
+
+		// If it failed, wait before retrying (unless its last attempt)
+		if attempt < policy.MaxRetries {
+			wait := withJitter(backoff, policy.Jitter)
+			if policy.MaxElapsed > 0 && time.Since(start)+wait > policy.MaxElapsed {
+				return fmt.Errorf("operation failed after %d attempts (%v elapsed): %w", attempt, time.Since(start).Round(time.Millisecond), err)
+			}
+			if policy.OnRetry != nil {
+				policy.OnRetry(attempt, err, wait)
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+				// Calculate next backoff duration
+				nextBackoff := float64(backoff) * policy.Multiplier
+				if nextBackoff > float64(policy.MaxBackoff) {
+					backoff = policy.MaxBackoff
+				} else {
+					backoff = time.Duration(nextBackoff)
+				}
+			}
+
+		}
+	}
+
+	return fmt.Errorf("operation failed after %d attempts: %w", policy.MaxRetries, err)
+
+}
+
+// withJitter spreads d uniformly over [d*(1-jitter), d*(1+jitter)]
+// so retries from many workers don't hit a recovering dependency in lockstep
+func withJitter(d time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 || d <= 0 {
+		return d
+	}
+	spread := (rand.Float64()*2 - 1) * jitter
+	return time.Duration(float64(d) * (1 + spread))
+}
@@ -0,0 +1,4 @@
+-- Migration: 002_feeds_post_index.sql
+
+-- Lets POST_DELETED remove a post from every feed without a full scan
+CREATE INDEX IF NOT EXISTS idx_feeds_post ON feeds(post_id);
@@ -0,0 +1,15 @@
+-- Migration: 003_post_revisions.sql
+
+-- Tracks the last applied edit so out-of-order POST_UPDATED events are ignored
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS last_edit_event_id BIGINT NOT NULL DEFAULT 0;
+
+-- Edit history (one row per replaced version)
+CREATE TABLE IF NOT EXISTS post_revisions(
+    post_id BIGINT NOT NULL REFERENCES posts(post_id) ON DELETE CASCADE,
+    revision INT NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    replaced_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (post_id,revision)
+);
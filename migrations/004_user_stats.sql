@@ -0,0 +1,22 @@
+-- Migration: 004_user_stats.sql
+
+-- Denormalized follow counts, kept in step with followers by FollowersRepo
+-- (repair drift with cmd/reconcile-stats)
+CREATE TABLE IF NOT EXISTS user_stats(
+    user_id VARCHAR(255) PRIMARY KEY,
+    follower_count BIGINT NOT NULL DEFAULT 0,
+    following_count BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_stats_follower_count ON user_stats(follower_count);
+
+-- Seed from existing follow edges
+INSERT INTO user_stats (user_id, follower_count, following_count)
+SELECT user_id, SUM(followers), SUM(following) FROM (
+    SELECT followee_id AS user_id, COUNT(*) AS followers, 0 AS following FROM followers GROUP BY followee_id
+    UNION ALL
+    SELECT follower_id AS user_id, 0 AS followers, COUNT(*) AS following FROM followers GROUP BY follower_id
+) counts
+GROUP BY user_id
+ON CONFLICT (user_id) DO NOTHING;
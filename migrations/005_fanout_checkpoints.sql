@@ -0,0 +1,19 @@
+-- Migration: 005_fanout_checkpoints.sql
+
+-- Keyset pagination over an author's followers (followee_id, follower_id)
+CREATE INDEX IF NOT EXISTS idx_followers_followee_follower ON followers(followee_id,follower_id);
+DROP INDEX IF EXISTS idx_followers_followee;
+
+-- Fan-outs larger than one chunk. The first chunk commits with the post and
+-- its processed_events row, together with this row; the processor then works
+-- through the remaining chunks one transaction each, moving the cursor
+-- forward, and deletes the row after the last one. A crashed fan-out is
+-- picked up again from last_follower_id.
+CREATE TABLE IF NOT EXISTS fanout_checkpoints(
+    event_id BIGINT PRIMARY KEY,
+    post_id BIGINT NOT NULL,
+    author_id VARCHAR(255) NOT NULL,
+    last_follower_id VARCHAR(255) NOT NULL,
+    next_chunk INT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
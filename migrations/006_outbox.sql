@@ -0,0 +1,16 @@
+-- Migration: 006_outbox.sql
+
+-- Transactional outbox: the API writes events here in the same transaction
+-- as its own writes, and the relay publishes them to Kafka in id order
+CREATE TABLE IF NOT EXISTS outbox(
+    id BIGSERIAL PRIMARY KEY,
+    event_id BIGINT NOT NULL UNIQUE,
+    partition_key VARCHAR(255) NOT NULL,
+    content_type VARCHAR(64) NOT NULL,
+    payload BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMP
+);
+
+-- The relay only ever scans unsent rows
+CREATE INDEX IF NOT EXISTS idx_outbox_unsent ON outbox(id) WHERE sent_at IS NULL;
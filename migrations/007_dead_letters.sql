@@ -0,0 +1,26 @@
+-- Migration: 007_dead_letters.sql
+
+-- Dead-lettered messages copied out of Kafka by the DLQ sink, so they outlive
+-- topic retention and can be reviewed, retried or discarded from the admin API
+CREATE TABLE IF NOT EXISTS dead_letters(
+    id BIGSERIAL PRIMARY KEY,
+    topic VARCHAR(255) NOT NULL,
+    partition INT NOT NULL,
+    kafka_offset BIGINT NOT NULL,
+    message_key BYTEA,
+    payload BYTEA NOT NULL,
+    headers JSONB NOT NULL DEFAULT '[]',
+    original_topic VARCHAR(255) NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    error_reason VARCHAR(64) NOT NULL DEFAULT '',
+    attempts INT NOT NULL DEFAULT 1,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    failed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    -- The sink may see a message twice (e.g. crash before its commit)
+    UNIQUE (topic, partition, kafka_offset)
+);
+
+-- Admin listing filters by status and pages by id
+CREATE INDEX IF NOT EXISTS idx_dead_letters_status ON dead_letters(status, id);
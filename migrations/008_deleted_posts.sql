@@ -0,0 +1,9 @@
+-- Migration: 008_deleted_posts.sql
+
+-- Tombstones for deleted posts. A POST_CREATED that was deferred to a retry
+-- tier can run after its POST_DELETED; the tombstone stops it from
+-- re-inserting and fanning out the deleted post.
+CREATE TABLE IF NOT EXISTS deleted_posts(
+    post_id BIGINT PRIMARY KEY,
+    deleted_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,7 @@
+-- Migration: 009_outbox_topic.sql
+
+-- The processor queues FEED_UPDATED events in the outbox too. An empty topic
+-- means the relay's default (post-events); feed updates carry no event id of
+-- their own, so event_id becomes optional (UNIQUE still holds for the rest).
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS topic VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE outbox ALTER COLUMN event_id DROP NOT NULL;
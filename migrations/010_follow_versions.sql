@@ -0,0 +1,12 @@
+-- Migration: 010_follow_versions.sql
+
+-- Last follow or unfollow applied to each edge, by event ID. Retry tiers let
+-- a later event for an edge overtake an earlier one; the older event is then
+-- skipped instead of re-creating or dropping the edge. Rows outlive the edge
+-- itself, so an unfollow leaves its version behind like a tombstone.
+CREATE TABLE IF NOT EXISTS follow_versions(
+    follower_id VARCHAR(255) NOT NULL,
+    followee_id VARCHAR(255) NOT NULL,
+    last_event_id BIGINT NOT NULL,
+    PRIMARY KEY (follower_id, followee_id)
+);